@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+	"golang.org/x/oauth2"
+
+	"github.com/carfloresf/reddit-bot/config"
+	"github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/metrics"
+	"github.com/carfloresf/reddit-bot/internal/pacer"
+	"github.com/carfloresf/reddit-bot/internal/redditauth"
+)
+
+// selectAccounts returns the accounts to handle: the one called name, or all
+// of them when name is empty.
+func selectAccounts(cfg *config.Config, name string) ([]config.Account, error) {
+	accounts := cfg.AccountList()
+	if name == "" {
+		return accounts, nil
+	}
+
+	for _, account := range accounts {
+		if account.Name == name {
+			return []config.Account{account}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown account %q", name)
+}
+
+// accountDB returns the view of the database holding an account's data. The
+// unnamed account of a single account config uses the database as is, so
+// data written before accounts existed stays in place.
+func accountDB(db badger.DB, account config.Account) badger.DB {
+	if account.Name == "" {
+		return db
+	}
+
+	return badger.NewPrefixedDB(db, "account_"+account.Name)
+}
+
+// newAccountService builds the Reddit client and delete service of an
+// account. All Reddit calls of the account share one pacer, so requests are
+// spread evenly over the rate-limit window Reddit reports for it.
+func newAccountService(ctx context.Context, db badger.DB, httpCfg config.HTTP, api config.API, account config.Account) (*DeleteService, error) {
+	transport := pacer.New(http.DefaultTransport, account.Reddit.RateBudget)
+	if err := metrics.RegisterRate(account.Name, transport); err != nil {
+		return nil, fmt.Errorf("register rate metrics: %w", err)
+	}
+
+	client, err := newRedditClient(ctx, accountDB(db, account), httpCfg, api, account.Reddit, transport)
+	if err != nil {
+		return nil, fmt.Errorf("create Reddit client: %w", err)
+	}
+
+	ds, err := NewDeleteService(client, accountDB(db, account), account.Name, account.Deleter)
+	if err != nil {
+		return nil, err
+	}
+	ds.linkBase = api.RedditOAuthURL
+
+	return ds, nil
+}
+
+// newRedditClient builds the Reddit client of an account on top of transport,
+// logging in with the password or with the stored refresh token.
+func newRedditClient(ctx context.Context, db badger.DB, httpCfg config.HTTP, api config.API, cfg config.Reddit, transport http.RoundTripper) (*reddit.Client, error) {
+	if cfg.Auth != config.AuthOAuth {
+		credentials := reddit.Credentials{
+			ID:       cfg.ClientID,
+			Secret:   cfg.Secret,
+			Username: cfg.Username,
+			Password: cfg.Password,
+		}
+
+		return reddit.NewClient(credentials,
+			reddit.WithHTTPClient(&http.Client{Transport: transport}),
+			reddit.WithBaseURL(api.RedditAPIURL),
+			reddit.WithTokenURL(redditauth.TokenURL(api.RedditOAuthURL)),
+			reddit.WithUserAgent(api.UserAgent),
+		)
+	}
+
+	store, err := redditauth.NewStore(db, cfg.TokenKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = redditauth.ClientContext(ctx, transport, api.UserAgent)
+	tokens, err := redditauth.TokenSource(ctx, oauthConfig(httpCfg, api, cfg), store)
+	if err != nil {
+		return nil, err
+	}
+
+	// The read-only client leaves authentication to the transport, which
+	// adds and refreshes the access token on every request.
+	httpClient := &http.Client{Transport: &oauth2.Transport{Source: tokens, Base: transport}}
+	client, err := reddit.NewReadonlyClient(
+		reddit.WithHTTPClient(httpClient),
+		reddit.WithBaseURL(api.RedditAPIURL),
+		reddit.WithUserAgent(api.UserAgent),
+	)
+	if err != nil {
+		return nil, err
+	}
+	client.Username = cfg.Username
+
+	return client, nil
+}
+
+// oauthConfig returns the OAuth configuration of an account, with the
+// callback served on the configured HTTP address.
+func oauthConfig(httpCfg config.HTTP, api config.API, cfg config.Reddit) *oauth2.Config {
+	redirectURL := "http://" + net.JoinHostPort(httpCfg.Addr, httpCfg.Port) + redditauth.CallbackPath
+
+	return redditauth.NewConfig(api.RedditOAuthURL, cfg.ClientID, cfg.Secret, redirectURL)
+}
+
+// runAuthorize implements the authorize subcommand. It captures a refresh
+// token for the account once, through a callback served on the HTTP address.
+func runAuthorize(ctx context.Context, db badger.DB, httpCfg config.HTTP, api config.API, cfg config.Reddit) error {
+	store, err := redditauth.NewStore(db, cfg.TokenKey)
+	if err != nil {
+		return err
+	}
+
+	ctx = redditauth.ClientContext(ctx, nil, api.UserAgent)
+	addr := net.JoinHostPort(httpCfg.Addr, httpCfg.Port)
+	if err := redditauth.Authorize(ctx, oauthConfig(httpCfg, api, cfg), addr, store); err != nil {
+		return err
+	}
+
+	log.Info("Refresh token stored, set auth: oauth to use it")
+
+	return nil
+}
+
+// accountPlanPath gives every account its own plan file when several
+// accounts run at once.
+func accountPlanPath(path string, account config.Account, accounts int) string {
+	if path == "" || accounts <= 1 || account.Name == "" {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "-" + account.Name + ext
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/rules"
+)
+
+const (
+	approvalNamespace = "approval"
+
+	approvalPending  = "pending"
+	approvalApproved = "approved"
+)
+
+// approvalItem is a selected target held for review. Entries stay until the
+// target is handed to the workers or rejected.
+type approvalItem struct {
+	Kind       string    `json:"kind"`
+	ID         string    `json:"id"`
+	FullID     string    `json:"full_id"`
+	Subreddit  string    `json:"subreddit"`
+	Title      string    `json:"title,omitempty"`
+	Body       string    `json:"body"`
+	Permalink  string    `json:"permalink"`
+	Score      int       `json:"score"`
+	Created    time.Time `json:"created"`
+	Rule       string    `json:"rule"`
+	Status     string    `json:"status"`
+	SelectedAt time.Time `json:"selected_at"`
+}
+
+// Key returns the key of the item within the approval namespace.
+func (a approvalItem) Key() string {
+	return archiveKey(newTarget(a.Kind, a.ID))
+}
+
+// Age renders how old the item is.
+func (a approvalItem) Age() string {
+	return formatAge(time.Since(a.Created))
+}
+
+// approved reports whether a selected target may go ahead. Targets the
+// deleter already started on were approved before; others are held for
+// review until a reviewer approves them.
+func (ds *DeleteService) approved(t target, decision rules.Decision) bool {
+	record, err := getRecord(ds.db, t)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to read state")
+		return false
+	}
+
+	if record.State != stateNone {
+		return true
+	}
+
+	item, found, err := getApproval(ds.db, archiveKey(t))
+	if err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to read approval")
+		return false
+	}
+
+	if found && item.Status == approvalApproved {
+		return true
+	}
+
+	if !found {
+		item = approvalItem{
+			Kind:       t.kind,
+			ID:         t.ID,
+			FullID:     t.FullID,
+			Subreddit:  t.Subreddit,
+			Title:      t.Title,
+			Body:       t.Body,
+			Permalink:  t.Permalink,
+			Score:      t.Score,
+			Created:    t.Created,
+			Rule:       decision.Rule,
+			Status:     approvalPending,
+			SelectedAt: time.Now(),
+		}
+
+		if err := setApproval(ds.db, item); err != nil {
+			log.WithFields(log.Fields{
+				"kind":  t.kind,
+				"id":    t.ID,
+				"error": err,
+			}).Error("Failed to hold for approval")
+			return false
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"kind": t.kind,
+		"id":   t.ID,
+	}).Info("Awaiting approval")
+	ds.tracker.Add("awaiting_approval", 1)
+
+	return false
+}
+
+// runApproved hands every approved target to the workers, whether or not it
+// still shows up in the listings, and waits for them to finish. Entries of
+// targets the deleter already started on, that are gone or that the
+// keep-list protects by now, are dropped.
+func (ds *DeleteService) runApproved(ctx context.Context, summary *runSummary) {
+	items, err := approvals(ds.db, approvalApproved)
+	if err != nil {
+		log.WithField("error", err).Error("Failed to read approvals")
+		return
+	}
+
+	if len(items) == 0 {
+		return
+	}
+
+	pool := ds.startPool(ctx, summary)
+	defer pool.wait()
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return
+		}
+
+		t := newTarget(item.Kind, item.ID)
+		record, err := getRecord(ds.db, t)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"kind":  t.kind,
+				"id":    t.ID,
+				"error": err,
+			}).Error("Failed to read state")
+			continue
+		}
+
+		if record.State == stateNone {
+			current, found, err := ds.fetchTarget(ctx, t)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"kind":  t.kind,
+					"id":    t.ID,
+					"error": err,
+				}).Error("Failed to fetch approved item")
+				continue
+			}
+
+			if found && !current.gone() {
+				reason, protected, err := ds.protected(current)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"kind":  t.kind,
+						"id":    t.ID,
+						"error": err,
+					}).Error("Failed to check keep-list")
+					continue
+				}
+
+				if !protected {
+					pool.add(current)
+					continue
+				}
+
+				log.WithFields(log.Fields{
+					"kind":   t.kind,
+					"id":     t.ID,
+					"reason": reason,
+				}).Info("Approved item is protected now, dropping it")
+			}
+		}
+
+		if err := ds.db.Delete([]byte(approvalNamespace), []byte(item.Key())); err != nil {
+			log.WithFields(log.Fields{
+				"kind":  t.kind,
+				"id":    t.ID,
+				"error": err,
+			}).Error("Failed to drop approval")
+		}
+	}
+}
+
+// approvals lists the held items with the given status, oldest first.
+func approvals(db badger.DB, status string) ([]approvalItem, error) {
+	var items []approvalItem
+	err := db.IteratePrefix([]byte(approvalNamespace), nil, func(_, value []byte) error {
+		var item approvalItem
+		if err := json.Unmarshal(value, &item); err != nil {
+			return err
+		}
+
+		if item.Status == status {
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Created.Before(items[j].Created)
+	})
+
+	return items, nil
+}
+
+// approve lets a held item go ahead on the next pass.
+func approve(db badger.DB, key string) error {
+	item, found, err := getApproval(db, key)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("%s is not awaiting approval", key)
+	}
+
+	item.Status = approvalApproved
+
+	return setApproval(db, item)
+}
+
+// approveAll approves every pending item and returns how many there were.
+func approveAll(db badger.DB) (int, error) {
+	items, err := approvals(db, approvalPending)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		item.Status = approvalApproved
+		if err := setApproval(db, item); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(items), nil
+}
+
+// reject drops a held item and adds it to the keep-list, so it is never
+// selected again.
+func reject(db badger.DB, key string) error {
+	item, found, err := getApproval(db, key)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("%s is not awaiting approval", key)
+	}
+
+	if err := addKeep(db, newTarget(item.Kind, item.ID).keepEntry()); err != nil {
+		return err
+	}
+
+	return db.Delete([]byte(approvalNamespace), []byte(key))
+}
+
+// runApprove implements the approve subcommand, the offline counterpart of
+// the review UI. Approved items are deleted on the next run. Listed items
+// link to the Reddit host at linkBase.
+func runApprove(db badger.DB, linkBase string, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: approve list | approve all | approve add|reject <key>...")
+	}
+
+	switch args[0] {
+	case "list":
+		items, err := approvals(db, approvalPending)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tSUBREDDIT\tAGE\tRULE\tLINK")
+		for _, item := range items {
+			fmt.Fprintf(tw, "%s\tr/%s\t%s\t%s\t%s\n", item.Key(), item.Subreddit, item.Age(), item.Rule, permalinkURL(linkBase, item.Permalink))
+		}
+		return tw.Flush()
+	case "all":
+		count, err := approveAll(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("approved %d\n", count)
+		return nil
+	case "add", "reject":
+		for _, key := range args[1:] {
+			var err error
+			if args[0] == "add" {
+				err = approve(db, key)
+			} else {
+				err = reject(db, key)
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s %s\n", args[0], key)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown approve action %q", args[0])
+	}
+}
+
+func getApproval(db badger.DB, key string) (approvalItem, bool, error) {
+	value, err := db.Get([]byte(approvalNamespace), []byte(key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return approvalItem{}, false, nil
+	}
+	if err != nil {
+		return approvalItem{}, false, err
+	}
+
+	var item approvalItem
+	if err := json.Unmarshal(value, &item); err != nil {
+		return approvalItem{}, false, err
+	}
+
+	return item, true, nil
+}
+
+func setApproval(db badger.DB, item approvalItem) error {
+	value, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return db.Set([]byte(approvalNamespace), []byte(item.Key()), value)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const archiveNamespace = "archive"
+
+// ArchivedItem is the copy of a comment or post saved before the deleter
+// changes it. Body always holds the original text; Replacement is set once
+// the item has been overwritten.
+type ArchivedItem struct {
+	Kind        string    `json:"kind"`
+	ID          string    `json:"id"`
+	Subreddit   string    `json:"subreddit"`
+	Title       string    `json:"title,omitempty"`
+	Body        string    `json:"body"`
+	Permalink   string    `json:"permalink"`
+	Score       int       `json:"score"`
+	Created     time.Time `json:"created"`
+	Edited      bool      `json:"edited"`
+	NSFW        bool      `json:"nsfw"`
+	Replacement string    `json:"replacement,omitempty"`
+	ArchivedAt  time.Time `json:"archived_at"`
+}
+
+// archiveKey returns the key of a target within the archive namespace.
+func archiveKey(t target) string {
+	return t.kind + "_" + t.ID
+}
+
+// archive saves the target unless it was archived before, so the original
+// text is never replaced by a later, already overwritten copy. It returns the
+// namespaced key the deletion record points to.
+func (ds *DeleteService) archive(t target) (string, error) {
+	key := archiveKey(t)
+	ref := archiveNamespace + "/" + key
+
+	exists, err := ds.db.Has([]byte(archiveNamespace), []byte(key))
+	if err != nil {
+		return "", err
+	}
+
+	if exists {
+		return ref, nil
+	}
+
+	value, err := json.Marshal(ArchivedItem{
+		Kind:       t.kind,
+		ID:         t.ID,
+		Subreddit:  t.Subreddit,
+		Title:      t.Title,
+		Body:       t.Body,
+		Permalink:  t.Permalink,
+		Score:      t.Score,
+		Created:    t.Created,
+		Edited:     t.Edited,
+		NSFW:       t.NSFW,
+		ArchivedAt: time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := ds.db.Set([]byte(archiveNamespace), []byte(key), value); err != nil {
+		return "", err
+	}
+
+	return ref, nil
+}
+
+// archiveReplacement records the text the archived target was overwritten to.
+func (ds *DeleteService) archiveReplacement(t target, text string) error {
+	key := []byte(archiveKey(t))
+
+	value, err := ds.db.Get([]byte(archiveNamespace), key)
+	if err != nil {
+		return err
+	}
+
+	var item ArchivedItem
+	if err := json.Unmarshal(value, &item); err != nil {
+		return err
+	}
+
+	item.Replacement = text
+
+	value, err = json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	return ds.db.Set([]byte(archiveNamespace), key, value)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+
+	"github.com/carfloresf/reddit-bot/internal/rules"
+)
+
+const (
+	cleanupNamespace = "cleanup"
+
+	cleanupSaved     = "saved"
+	cleanupUpvoted   = "upvoted"
+	cleanupDownvoted = "downvoted"
+)
+
+// Outcomes of clearing a single item.
+const (
+	outcomeCleared    = "cleared"
+	outcomeWouldClear = "would_clear"
+	outcomeKept       = "kept"
+	outcomeDoneBefore = "done_before"
+)
+
+// cleanupListing is a listing of the user whose items can be cleared: saved
+// items are unsaved, voted ones have their vote removed.
+type cleanupListing struct {
+	fetch clearingFetch
+	clear func(ctx context.Context, t target) (*reddit.Response, error)
+}
+
+// cleanupListings returns the listings the cleanup modes work on.
+func (ds *DeleteService) cleanupListings() map[string]cleanupListing {
+	removeVote := func(ctx context.Context, t target) (*reddit.Response, error) {
+		return ds.client.Post.RemoveVote(ctx, t.FullID)
+	}
+
+	return map[string]cleanupListing{
+		cleanupSaved: {
+			fetch: func(ctx context.Context, opts *reddit.ListOptions) ([]target, *reddit.Response, error) {
+				posts, comments, response, err := ds.client.User.Saved(ctx, userListing(opts))
+				if err != nil {
+					return nil, nil, err
+				}
+				return append(postTargets(posts), commentTargets(comments)...), response, nil
+			},
+			clear: func(ctx context.Context, t target) (*reddit.Response, error) {
+				if t.kind == kindPost {
+					return ds.client.Post.Unsave(ctx, t.FullID)
+				}
+				return ds.client.Comment.Unsave(ctx, t.FullID)
+			},
+		},
+		cleanupUpvoted: {
+			fetch: postListing(ds.client.User.Upvoted),
+			clear: removeVote,
+		},
+		cleanupDownvoted: {
+			fetch: postListing(ds.client.User.Downvoted),
+			clear: removeVote,
+		},
+	}
+}
+
+// userListing turns page options into those of a user listing over all time.
+func userListing(opts *reddit.ListOptions) *reddit.ListUserOverviewOptions {
+	return &reddit.ListUserOverviewOptions{ListOptions: *opts, Time: "all"}
+}
+
+func postListing(list listFunc[*reddit.Post]) clearingFetch {
+	return func(ctx context.Context, opts *reddit.ListOptions) ([]target, *reddit.Response, error) {
+		posts, response, err := list(ctx, userListing(opts))
+		if err != nil {
+			return nil, nil, err
+		}
+		return postTargets(posts), response, nil
+	}
+}
+
+func postTargets(posts []*reddit.Post) []target {
+	targets := make([]target, len(posts))
+	for i, post := range posts {
+		targets[i] = postTarget(post)
+	}
+
+	return targets
+}
+
+func commentTargets(comments []*reddit.Comment) []target {
+	targets := make([]target, len(comments))
+	for i, comment := range comments {
+		targets[i] = commentTarget(comment)
+	}
+
+	return targets
+}
+
+// validateCleanup checks the names of the configured cleanup listings.
+func validateCleanup(names []string) error {
+	for _, name := range names {
+		switch name {
+		case cleanupSaved, cleanupUpvoted, cleanupDownvoted:
+		default:
+			return fmt.Errorf("unknown cleanup listing %q", name)
+		}
+	}
+
+	return nil
+}
+
+// runCleanup walks a listing and clears every item the rules select. Cleared
+// items are recorded in badger and never cleared twice; in dry-run mode
+// nothing is cleared or recorded.
+func (ds *DeleteService) runCleanup(ctx context.Context, name string) error {
+	listing, ok := ds.cleanupListings()[name]
+	if !ok {
+		return fmt.Errorf("unknown cleanup listing %q", name)
+	}
+
+	counts, err := ds.walkClearing(ctx, name, listing.fetch, outcomeCleared, func(t target) string {
+		return ds.cleanupItem(ctx, name, listing, t)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"listing":         name,
+		outcomeCleared:    counts[outcomeCleared],
+		outcomeWouldClear: counts[outcomeWouldClear],
+		outcomeKept:       counts[outcomeKept],
+		outcomeDoneBefore: counts[outcomeDoneBefore],
+		outcomeFailed:     counts[outcomeFailed],
+	}).Info("Cleanup summary")
+
+	return nil
+}
+
+// clearingFetch requests a page of a listing the deleter removes items from.
+type clearingFetch func(ctx context.Context, opts *reddit.ListOptions) ([]target, *reddit.Response, error)
+
+// walkClearing calls handle for every item of a listing and counts the
+// outcomes. Items handled with the removed outcome drop out of the listing, so
+// each page is requested after the last item left in place rather than after
+// the last item returned.
+func (ds *DeleteService) walkClearing(ctx context.Context, name string, fetch clearingFetch, removed string, handle func(target) string) (map[string]int, error) {
+	counts := make(map[string]int)
+	after := ""
+
+	for {
+		items, response, err := fetch(ctx, &reddit.ListOptions{
+			Limit: listingPageSize,
+			After: after,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s: %w", name, err)
+		}
+
+		lastKept := ""
+		for _, t := range items {
+			if err := ds.tracker.WaitIfPaused(ctx); err != nil {
+				return nil, err
+			}
+
+			outcome := handle(t)
+			counts[outcome]++
+			ds.tracker.Add(name+"_"+outcome, 1)
+			if outcome != removed {
+				lastKept = t.FullID
+			}
+		}
+
+		if len(items) == 0 || response.After == "" {
+			break
+		}
+
+		if lastKept != "" {
+			after = lastKept
+		}
+	}
+
+	return counts, nil
+}
+
+// cleanupItem applies the rules to one item of a listing and clears it if it
+// is selected.
+func (ds *DeleteService) cleanupItem(ctx context.Context, name string, listing cleanupListing, t target) string {
+	key := []byte(name + ":" + t.FullID)
+
+	decision := ds.rules.Evaluate(t.item())
+	log.WithFields(log.Fields{
+		"listing":   name,
+		"id":        t.FullID,
+		"subreddit": t.Subreddit,
+		"rule":      decision.Rule,
+		"action":    decision.Action,
+	}).Info("Rule decided action")
+
+	if decision.Action != rules.ActionDelete {
+		return outcomeKept
+	}
+
+	if ds.dryRun {
+		return outcomeWouldClear
+	}
+
+	done, err := ds.db.Has([]byte(cleanupNamespace), key)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"listing": name,
+			"id":      t.FullID,
+			"error":   err,
+		}).Error("Failed to read cleanup progress")
+		return outcomeFailed
+	}
+
+	// Reddit may keep listing an item for a while after it was cleared.
+	if done {
+		return outcomeDoneBefore
+	}
+
+	if _, err := listing.clear(ctx, t); err != nil {
+		log.WithFields(log.Fields{
+			"listing": name,
+			"id":      t.FullID,
+			"error":   err,
+		}).Error("Failed to clear")
+		return outcomeFailed
+	}
+
+	if err := ds.db.Set([]byte(cleanupNamespace), key, []byte(time.Now().Format(time.RFC3339))); err != nil {
+		log.WithFields(log.Fields{
+			"listing": name,
+			"id":      t.FullID,
+			"error":   err,
+		}).Error("Failed to record cleanup progress")
+	}
+
+	return outcomeCleared
+}
+
+// runCleanupCommand implements the cleanup subcommand. It clears the listings
+// named in args, or the configured ones when none are named.
+func (ds *DeleteService) runCleanupCommand(ctx context.Context, args []string) error {
+	names := args
+	if len(names) == 0 {
+		names = ds.cleanup
+	}
+
+	if len(names) == 0 {
+		return errors.New("usage: cleanup saved|upvoted|downvoted...")
+	}
+
+	if err := validateCleanup(names); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err := ds.runCleanup(ctx, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/carfloresf/reddit-bot/config"
+	"github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/fakereddit"
+	"github.com/carfloresf/reddit-bot/internal/pacer"
+)
+
+const testUser = "alice"
+
+// newTestService returns a delete service talking to a fake Reddit through a
+// pacer, with overwriting to fixed text enabled.
+func newTestService(t *testing.T, fake *fakereddit.Server) (*DeleteService, *pacer.Pacer) {
+	t.Helper()
+
+	db, err := badger.NewBadgerDB(t.TempDir())
+	if err != nil {
+		t.Fatalf("open database: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	api := config.API{RedditAPIURL: fake.URL, RedditOAuthURL: fake.URL, UserAgent: "test"}
+	credentials := config.Reddit{ClientID: "id", Secret: "secret", Username: testUser, Password: "password"}
+
+	transport := pacer.New(nil, 0)
+	client, err := newRedditClient(context.Background(), db, config.HTTP{}, api, credentials, transport)
+	if err != nil {
+		t.Fatalf("create client: %s", err)
+	}
+
+	ds, err := NewDeleteService(client, db, testUser, config.Deleter{
+		Overwrite: config.Overwrite{Enabled: true, Mode: overwriteModeFixed, Text: "overwritten"},
+		Workers:   2,
+		Order:     orderListing,
+		Retry:     config.Retry{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("create service: %s", err)
+	}
+
+	return ds, transport
+}
+
+func TestRunDeletesOldComments(t *testing.T) {
+	fake := fakereddit.New(testUser)
+	defer fake.Close()
+
+	old := time.Now().Add(-48 * time.Hour)
+	fake.AddComment(fakereddit.Comment{ID: "old1", Subreddit: "golang", Body: "first", Created: old})
+	fake.AddComment(fakereddit.Comment{ID: "new1", Subreddit: "golang", Body: "recent"})
+	fake.AddComment(fakereddit.Comment{ID: "old2", Subreddit: "rust", Body: "second", Created: old})
+
+	ds, transport := newTestService(t, fake)
+
+	if err := ds.Run(context.Background(), ""); err != nil {
+		t.Fatalf("run: %s", err)
+	}
+
+	for _, id := range []string{"old1", "old2"} {
+		c, _ := fake.Comment(id)
+		if !c.Deleted || !c.Edited || c.Body != "overwritten" {
+			t.Errorf("comment %s: deleted %t, edited %t, body %q; want overwritten and deleted", id, c.Deleted, c.Edited, c.Body)
+		}
+
+		record, err := getRecord(ds.db, newTarget(kindComment, id))
+		if err != nil {
+			t.Fatalf("read record: %s", err)
+		}
+		if record.State != stateVerifiedGone {
+			t.Errorf("comment %s: state %s, want %s", id, record.State, stateVerifiedGone)
+		}
+	}
+
+	if c, _ := fake.Comment("new1"); c.Deleted || c.Edited {
+		t.Errorf("recent comment was changed")
+	}
+
+	if rate := transport.Rate(); rate.Used == 0 {
+		t.Errorf("pacer saw no rate-limit headers")
+	}
+}
+
+func TestProcessComment(t *testing.T) {
+	fake := fakereddit.New(testUser)
+	defer fake.Close()
+
+	fake.AddComment(fakereddit.Comment{ID: "c1", Subreddit: "golang", Body: "text", Created: time.Now().Add(-48 * time.Hour)})
+
+	ds, _ := newTestService(t, fake)
+
+	comments, _, err := ds.client.User.Comments(context.Background(), nil)
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("list comments: %d comments, error %v", len(comments), err)
+	}
+
+	ds.processComment(context.Background(), comments[0])
+
+	if c, _ := fake.Comment("c1"); !c.Deleted {
+		t.Errorf("comment not deleted")
+	}
+}
+
+func TestRunFailedDeletions(t *testing.T) {
+	tests := []struct {
+		name   string
+		inject func(fake *fakereddit.Server)
+		state  string
+		queue  string
+	}{
+		{
+			name:   "server error is retried",
+			inject: func(fake *fakereddit.Server) { fake.Fail("/api/del", http.StatusServiceUnavailable, 1) },
+			state:  stateFailed,
+			queue:  retryNamespace,
+		},
+		{
+			name:   "forbidden goes to the dead-letter list",
+			inject: func(fake *fakereddit.Server) { fake.Fail("/api/del", http.StatusForbidden, 1) },
+			state:  stateDeadLetter,
+			queue:  deadLetterNamespace,
+		},
+		{
+			name:   "locked thread goes to the dead-letter list",
+			inject: func(fake *fakereddit.Server) { fake.Reject("/api/del", "THREAD_LOCKED", 1) },
+			state:  stateDeadLetter,
+			queue:  deadLetterNamespace,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakereddit.New(testUser)
+			defer fake.Close()
+
+			fake.AddComment(fakereddit.Comment{ID: "c1", Subreddit: "golang", Body: "text", Created: time.Now().Add(-48 * time.Hour)})
+			tt.inject(fake)
+
+			ds, _ := newTestService(t, fake)
+
+			if err := ds.Run(context.Background(), ""); err != nil {
+				t.Fatalf("run: %s", err)
+			}
+
+			if c, _ := fake.Comment("c1"); c.Deleted {
+				t.Errorf("comment deleted despite the injected error")
+			}
+
+			target := newTarget(kindComment, "c1")
+			record, err := getRecord(ds.db, target)
+			if err != nil {
+				t.Fatalf("read record: %s", err)
+			}
+			if record.State != tt.state {
+				t.Errorf("state %s, want %s", record.State, tt.state)
+			}
+
+			queued, err := ds.db.Has([]byte(tt.queue), retryKey(target))
+			if err != nil {
+				t.Fatalf("read %s: %s", tt.queue, err)
+			}
+			if !queued {
+				t.Errorf("comment not in %s", tt.queue)
+			}
+		})
+	}
+}
+
+func TestRunPaginatesComments(t *testing.T) {
+	fake := fakereddit.New(testUser)
+	defer fake.Close()
+
+	// More comments than fit on one listing page.
+	old := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < listingPageSize+50; i++ {
+		fake.AddComment(fakereddit.Comment{ID: fmt.Sprintf("c%d", i), Subreddit: "golang", Body: "text", Created: old})
+	}
+
+	ds, _ := newTestService(t, fake)
+
+	if err := ds.Run(context.Background(), ""); err != nil {
+		t.Fatalf("run: %s", err)
+	}
+
+	for i := 0; i < listingPageSize+50; i++ {
+		id := fmt.Sprintf("c%d", i)
+		if c, _ := fake.Comment(id); !c.Deleted {
+			t.Errorf("comment %s not deleted", id)
+		}
+	}
+
+	if pages := fake.Requests("/user/" + testUser + "/comments"); pages < 2 {
+		t.Errorf("comments listing fetched %d times, want at least 2 pages", pages)
+	}
+}
+
+func TestRunDeletesOldPosts(t *testing.T) {
+	fake := fakereddit.New(testUser)
+	defer fake.Close()
+
+	old := time.Now().Add(-48 * time.Hour)
+	fake.AddPost(fakereddit.Post{ID: "self1", Subreddit: "golang", Title: "self", Body: "text", Created: old})
+	fake.AddPost(fakereddit.Post{ID: "link1", Subreddit: "golang", Title: "link", URL: "https://example.com", Created: old})
+	fake.AddPost(fakereddit.Post{ID: "new1", Subreddit: "golang", Title: "recent", Body: "text"})
+
+	ds, _ := newTestService(t, fake)
+
+	if err := ds.Run(context.Background(), ""); err != nil {
+		t.Fatalf("run: %s", err)
+	}
+
+	if p, _ := fake.Post("self1"); !p.Deleted || !p.Edited || p.Body != "overwritten" {
+		t.Errorf("self post: deleted %t, edited %t, body %q; want overwritten and deleted", p.Deleted, p.Edited, p.Body)
+	}
+
+	if p, _ := fake.Post("link1"); !p.Deleted || p.Edited {
+		t.Errorf("link post: deleted %t, edited %t; want deleted without an edit", p.Deleted, p.Edited)
+	}
+
+	if p, _ := fake.Post("new1"); p.Deleted || p.Edited {
+		t.Errorf("recent post was changed")
+	}
+
+	for _, id := range []string{"self1", "link1"} {
+		record, err := getRecord(ds.db, newTarget(kindPost, id))
+		if err != nil {
+			t.Fatalf("read record: %s", err)
+		}
+		if record.State != stateVerifiedGone {
+			t.Errorf("post %s: state %s, want %s", id, record.State, stateVerifiedGone)
+		}
+	}
+}
+
+func TestRunPausesWhenRateLimitExhausted(t *testing.T) {
+	fake := fakereddit.New(testUser)
+	defer fake.Close()
+
+	fake.AddComment(fakereddit.Comment{ID: "c1", Subreddit: "golang", Body: "text", Created: time.Now().Add(-48 * time.Hour)})
+
+	// A run takes more requests than a window allows, so the pacer has to
+	// wait for the window to reset rather than spend the last request.
+	const window = time.Second
+	fake.SetRateLimit(4, window)
+	start := time.Now()
+
+	ds, _ := newTestService(t, fake)
+
+	if err := ds.Run(context.Background(), ""); err != nil {
+		t.Fatalf("run: %s", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < window {
+		t.Errorf("run took %s, want a pause of at least %s", elapsed, window)
+	}
+
+	if c, _ := fake.Comment("c1"); !c.Deleted {
+		t.Errorf("comment not deleted")
+	}
+}
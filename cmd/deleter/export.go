@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	exportFormatJSONL    = "jsonl"
+	exportFormatCSV      = "csv"
+	exportFormatMarkdown = "markdown"
+
+	exportDateLayout = "2006-01-02"
+)
+
+var csvHeader = []string{
+	"kind", "id", "subreddit", "created", "score", "edited", "nsfw", "permalink", "title", "body", "replacement",
+}
+
+type (
+	// exportFilter selects the archived items an export includes.
+	exportFilter struct {
+		from       time.Time
+		to         time.Time
+		subreddits map[string]struct{}
+	}
+
+	// exportWriter writes archived items in one output format.
+	exportWriter interface {
+		Write(item ArchivedItem) error
+		Close() error
+	}
+)
+
+// runExport implements the export subcommand. It streams the archive
+// namespace and writes every item matching the filters, linking items on the
+// Reddit host at linkBase.
+func runExport(db badger.DB, linkBase string, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", exportFormatJSONL, "output format: jsonl, csv or markdown")
+	out := fs.String("out", "", "output file, or directory for markdown; defaults to stdout for jsonl and csv")
+	from := fs.String("from", "", "only export items created on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "only export items created before this date (YYYY-MM-DD)")
+	subreddits := fs.String("subreddit", "", "comma separated subreddits to export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter, err := newExportFilter(*from, *to, *subreddits)
+	if err != nil {
+		return err
+	}
+
+	w, err := newExportWriter(*format, *out, linkBase)
+	if err != nil {
+		return err
+	}
+
+	err = db.IteratePrefix([]byte(archiveNamespace), nil, func(_, value []byte) error {
+		var item ArchivedItem
+		if err := json.Unmarshal(value, &item); err != nil {
+			return err
+		}
+
+		if !filter.match(item) {
+			return nil
+		}
+
+		return w.Write(item)
+	})
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+func newExportFilter(from, to, subreddits string) (exportFilter, error) {
+	var filter exportFilter
+	var err error
+
+	if from != "" {
+		if filter.from, err = time.Parse(exportDateLayout, from); err != nil {
+			return exportFilter{}, fmt.Errorf("from: %w", err)
+		}
+	}
+
+	if to != "" {
+		if filter.to, err = time.Parse(exportDateLayout, to); err != nil {
+			return exportFilter{}, fmt.Errorf("to: %w", err)
+		}
+	}
+
+	if subreddits != "" {
+		filter.subreddits = make(map[string]struct{})
+		for _, s := range strings.Split(subreddits, ",") {
+			filter.subreddits[strings.ToLower(strings.TrimSpace(s))] = struct{}{}
+		}
+	}
+
+	return filter, nil
+}
+
+func (f exportFilter) match(item ArchivedItem) bool {
+	if !f.from.IsZero() && item.Created.Before(f.from) {
+		return false
+	}
+
+	if !f.to.IsZero() && !item.Created.Before(f.to) {
+		return false
+	}
+
+	if f.subreddits != nil {
+		if _, ok := f.subreddits[strings.ToLower(item.Subreddit)]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newExportWriter(format, out, linkBase string) (exportWriter, error) {
+	switch format {
+	case exportFormatJSONL, exportFormatCSV:
+		file, err := createOutput(out)
+		if err != nil {
+			return nil, err
+		}
+
+		if format == exportFormatJSONL {
+			return &jsonlWriter{file: file, enc: json.NewEncoder(file)}, nil
+		}
+
+		w := &csvWriter{file: file, w: csv.NewWriter(file), linkBase: linkBase}
+		if err := w.w.Write(csvHeader); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return w, nil
+	case exportFormatMarkdown:
+		if out == "" {
+			return nil, fmt.Errorf("markdown export needs an output directory")
+		}
+		if err := os.MkdirAll(out, 0774); err != nil {
+			return nil, err
+		}
+		return &markdownWriter{dir: out, linkBase: linkBase, started: make(map[string]bool)}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+// createOutput opens the output file, or stdout when no path is given.
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "" {
+		return nopCloser{os.Stdout}, nil
+	}
+
+	return os.Create(path)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+type jsonlWriter struct {
+	file io.WriteCloser
+	enc  *json.Encoder
+}
+
+func (w *jsonlWriter) Write(item ArchivedItem) error {
+	return w.enc.Encode(item)
+}
+
+func (w *jsonlWriter) Close() error {
+	return w.file.Close()
+}
+
+type csvWriter struct {
+	file     io.WriteCloser
+	w        *csv.Writer
+	linkBase string
+}
+
+func (w *csvWriter) Write(item ArchivedItem) error {
+	return w.w.Write([]string{
+		item.Kind,
+		item.ID,
+		item.Subreddit,
+		item.Created.Format(time.RFC3339),
+		strconv.Itoa(item.Score),
+		strconv.FormatBool(item.Edited),
+		strconv.FormatBool(item.NSFW),
+		permalinkURL(w.linkBase, item.Permalink),
+		item.Title,
+		item.Body,
+		item.Replacement,
+	})
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
+
+// markdownWriter writes one Markdown file per subreddit. Subreddit names
+// are case-insensitive, so files are named after the lowercased name. A file
+// is only open while an item is written to it, keeping exports of many
+// subreddits within the open file limit.
+type markdownWriter struct {
+	dir      string
+	linkBase string
+	started  map[string]bool
+}
+
+func (w *markdownWriter) Write(item ArchivedItem) error {
+	subreddit := item.Subreddit
+	if subreddit == "" {
+		subreddit = "unknown"
+	}
+	name := strings.ToLower(subreddit)
+	path := filepath.Join(w.dir, name+".md")
+
+	// The first item of a subreddit replaces any file left by an earlier
+	// export; later items are appended.
+	flags := os.O_WRONLY | os.O_APPEND
+	if !w.started[name] {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return err
+	}
+
+	if !w.started[name] {
+		w.started[name] = true
+
+		if _, err := fmt.Fprintf(file, "# r/%s\n\n", subreddit); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	heading := item.Title
+	if heading == "" {
+		heading = "Comment " + item.ID
+	}
+
+	if _, err := fmt.Fprintf(file, "## %s\n\n%s · score %d · %s\n\n%s\n\n---\n\n",
+		heading, item.Created.Format(exportDateLayout), item.Score, permalinkURL(w.linkBase, item.Permalink), item.Body); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (w *markdownWriter) Close() error {
+	return nil
+}
+
+// permalinkURL returns the link to a permalink on the Reddit host at base.
+func permalinkURL(base, permalink string) string {
+	return strings.TrimSuffix(base, "/") + permalink
+}
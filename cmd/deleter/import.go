@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	importNamespace = "import"
+
+	importQueued  = "queued"
+	importDone    = "done"
+	importMissing = "missing"
+
+	// infoBatchSize is the number of fullnames the info endpoint accepts.
+	infoBatchSize = 100
+
+	deletedAuthor = "[deleted]"
+	deletedBody   = "[deleted]"
+	removedBody   = "[removed]"
+)
+
+// runImport implements the import subcommand. It queues every ID found in the
+// comments.csv and posts.csv files of Reddit's data request archive, then
+// fetches the queued items and runs them through the deleter. Progress is kept
+// per ID, so the command can be re-run until nothing is left queued.
+func (ds *DeleteService) runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	comments := fs.String("comments", "", "path to comments.csv from the data request archive")
+	posts := fs.String("posts", "", "path to posts.csv from the data request archive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *comments != "" {
+		if err := ds.queueImport(*comments, "t1_"); err != nil {
+			return fmt.Errorf("queue comments: %w", err)
+		}
+	}
+
+	if *posts != "" {
+		if err := ds.queueImport(*posts, "t3_"); err != nil {
+			return fmt.Errorf("queue posts: %w", err)
+		}
+	}
+
+	return ds.processImport(ctx)
+}
+
+// queueImport reads the id column of an archive CSV and queues each item that
+// is not tracked yet under its fullname.
+func (ds *DeleteService) queueImport(path, prefix string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	header, err := r.Read()
+	if err != nil {
+		return err
+	}
+
+	idColumn := -1
+	for i, name := range header {
+		if strings.TrimSpace(name) == "id" {
+			idColumn = i
+		}
+	}
+	if idColumn < 0 {
+		return fmt.Errorf("%s has no id column", path)
+	}
+
+	queued := 0
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		fullID := []byte(prefix + row[idColumn])
+
+		exists, err := ds.db.Has([]byte(importNamespace), fullID)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if err := ds.db.Set([]byte(importNamespace), fullID, []byte(importQueued)); err != nil {
+			return err
+		}
+		queued++
+	}
+
+	log.WithFields(log.Fields{
+		"path":   path,
+		"queued": queued,
+	}).Info("Queued items from archive")
+
+	return nil
+}
+
+// processImport fetches queued items by fullname in batches and hands each to
+// the same pipeline the listings use. Items Reddit no longer returns are
+// recorded as missing.
+func (ds *DeleteService) processImport(ctx context.Context) error {
+	var queued []string
+	err := ds.db.IteratePrefix([]byte(importNamespace), nil, func(key, value []byte) error {
+		if string(value) == importQueued {
+			queued = append(queued, string(key))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.WithField("queued", len(queued)).Info("Processing imported items")
+
+	for start := 0; start < len(queued); start += infoBatchSize {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		batch := queued[start:min(start+infoBatchSize, len(queued))]
+
+		posts, comments, _, _, err := ds.client.Listings.Get(ctx, batch...)
+		if err != nil {
+			return err
+		}
+
+		targets := append(postTargets(posts), commentTargets(comments)...)
+
+		status := make(map[string]string, len(batch))
+		for _, t := range targets {
+			status[t.FullID] = ds.importItem(ctx, t)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// A dry run leaves the queue untouched so the real run sees every item.
+		if ds.dryRun {
+			continue
+		}
+
+		for _, fullID := range batch {
+			s, ok := status[fullID]
+			if !ok {
+				s = importMissing
+			}
+
+			if err := ds.db.Set([]byte(importNamespace), []byte(fullID), []byte(s)); err != nil {
+				return err
+			}
+		}
+	}
+
+	counts, err := importProgress(ds.db)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		importQueued:  counts[importQueued],
+		importDone:    counts[importDone],
+		importMissing: counts[importMissing],
+	}).Info("Import finished")
+
+	return nil
+}
+
+// importItem runs a fetched item through the deleter and returns its import
+// status. Only items that are deleted, or were already, are done; items the
+// rules keep, that wait for approval or whose deletion failed stay queued, as
+// the listings may never show them again. Failed deletions also go to the
+// retry queue.
+func (ds *DeleteService) importItem(ctx context.Context, t target) string {
+	if t.deleted {
+		return importDone
+	}
+
+	if !ds.decide(t) || ds.dryRun {
+		return importQueued
+	}
+
+	switch ds.execute(ctx, t) {
+	case outcomeDeleted, outcomeAlreadyDeleted:
+		return importDone
+	default:
+		return importQueued
+	}
+}
+
+// importProgress counts the tracked import IDs by status.
+func importProgress(db badger.DB) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := db.IteratePrefix([]byte(importNamespace), nil, func(_, value []byte) error {
+		counts[string(value)]++
+		return nil
+	})
+
+	return counts, err
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+
+	"github.com/carfloresf/reddit-bot/internal/rules"
+)
+
+const (
+	kindMessage = "message"
+
+	messagesNamespace = "deleter_messages"
+
+	inboxReceived = "inbox"
+	inboxSent     = "sent"
+
+	outcomeWouldDelete = "would_delete"
+)
+
+// inboxFolders are the message folders the inbox cleanup works on.
+var inboxFolders = []string{inboxReceived, inboxSent}
+
+func messageTarget(message *reddit.Message) target {
+	t := target{
+		kind:   kindMessage,
+		ID:     message.ID,
+		FullID: message.FullID,
+		Title:  message.Subject,
+		Body:   message.Text,
+	}
+	if message.Created != nil {
+		t.Created = message.Created.Time
+	}
+
+	return t
+}
+
+func messageTargets(messages []*reddit.Message) []target {
+	targets := make([]target, len(messages))
+	for i, message := range messages {
+		targets[i] = messageTarget(message)
+	}
+
+	return targets
+}
+
+// inboxListings returns the message folders. Comment replies also show up in
+// the inbox; they belong to their authors and are left alone.
+func (ds *DeleteService) inboxListings() map[string]clearingFetch {
+	return map[string]clearingFetch{
+		inboxReceived: func(ctx context.Context, opts *reddit.ListOptions) ([]target, *reddit.Response, error) {
+			_, messages, response, err := ds.client.Message.Inbox(ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return messageTargets(messages), response, nil
+		},
+		inboxSent: func(ctx context.Context, opts *reddit.ListOptions) ([]target, *reddit.Response, error) {
+			messages, response, err := ds.client.Message.Sent(ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+			return messageTargets(messages), response, nil
+		},
+	}
+}
+
+// runInbox walks the given message folders and deletes every message the
+// inbox rules select. Deleted messages are recorded in badger like comments
+// and never deleted twice; in dry-run mode nothing is deleted or recorded.
+func (ds *DeleteService) runInbox(ctx context.Context, folders []string) error {
+	if ds.inboxRules == nil {
+		return errors.New("no inbox rules configured")
+	}
+
+	listings := ds.inboxListings()
+	for _, name := range folders {
+		fetch, ok := listings[name]
+		if !ok {
+			return fmt.Errorf("unknown message folder %q", name)
+		}
+
+		counts, err := ds.walkClearing(ctx, name, fetch, outcomeDeleted, func(t target) string {
+			return ds.inboxItem(ctx, name, t)
+		})
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"folder":           name,
+			outcomeDeleted:     counts[outcomeDeleted],
+			outcomeWouldDelete: counts[outcomeWouldDelete],
+			outcomeKept:        counts[outcomeKept],
+			outcomeDoneBefore:  counts[outcomeDoneBefore],
+			outcomeFailed:      counts[outcomeFailed],
+		}).Info("Inbox summary")
+	}
+
+	return nil
+}
+
+// inboxItem applies the inbox rules to a message and deletes it if it is
+// selected.
+func (ds *DeleteService) inboxItem(ctx context.Context, folder string, t target) string {
+	decision := ds.inboxRules.Evaluate(t.item())
+	log.WithFields(log.Fields{
+		"folder": folder,
+		"id":     t.FullID,
+		"rule":   decision.Rule,
+		"action": decision.Action,
+	}).Info("Rule decided action")
+
+	if decision.Action != rules.ActionDelete {
+		return outcomeKept
+	}
+
+	if ds.dryRun {
+		return outcomeWouldDelete
+	}
+
+	record, err := getRecord(ds.db, t)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"folder": folder,
+			"id":     t.FullID,
+			"error":  err,
+		}).Error("Failed to read state")
+		return outcomeFailed
+	}
+
+	// Reddit may keep listing a message for a while after it was deleted.
+	if record.State == stateDeleteRequested {
+		return outcomeDoneBefore
+	}
+
+	// A message left selected by an interrupted run is picked up as is.
+	if record.State != stateSelected {
+		if err := moveRecord(ds.db, t, &record, stateSelected, nil); err != nil {
+			log.WithFields(log.Fields{
+				"folder": folder,
+				"id":     t.FullID,
+				"error":  err,
+			}).Error("Failed to record state")
+			return outcomeFailed
+		}
+	}
+
+	if _, err := ds.client.Message.Delete(ctx, t.FullID); err != nil {
+		log.WithFields(log.Fields{
+			"folder": folder,
+			"id":     t.FullID,
+			"error":  err,
+		}).Error("Failed to delete message")
+
+		if err := moveRecord(ds.db, t, &record, stateFailed, err); err != nil {
+			log.WithFields(log.Fields{
+				"folder": folder,
+				"id":     t.FullID,
+				"error":  err,
+			}).Error("Failed to record state")
+		}
+		return outcomeFailed
+	}
+
+	if err := moveRecord(ds.db, t, &record, stateDeleteRequested, nil); err != nil {
+		log.WithFields(log.Fields{
+			"folder": folder,
+			"id":     t.FullID,
+			"error":  err,
+		}).Error("Failed to record state")
+	}
+
+	return outcomeDeleted
+}
+
+// runInboxCommand implements the inbox subcommand. It clears the message
+// folders named in args, or both when none are named.
+func (ds *DeleteService) runInboxCommand(ctx context.Context, args []string) error {
+	folders := args
+	if len(folders) == 0 {
+		folders = inboxFolders
+	}
+
+	return ds.runInbox(ctx, folders)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/term"
+
+	"github.com/carfloresf/reddit-bot/internal/rules"
+)
+
+const (
+	reviewNamespace = "review"
+
+	reviewKeep          = "keep"
+	reviewDelete        = "delete"
+	reviewOverwriteOnly = "overwrite_only"
+	reviewSkip          = "skip"
+	reviewKeepSubreddit = "keep_subreddit"
+)
+
+// errQuit stops an interactive review session.
+var errQuit = errors.New("review quit")
+
+// reviewKeys maps the keys of the interactive review to decisions.
+var reviewKeys = map[byte]string{
+	'k': reviewKeep,
+	'd': reviewDelete,
+	'o': reviewOverwriteOnly,
+	's': reviewSkip,
+	'r': reviewKeepSubreddit,
+}
+
+// reviewDecision is what a reviewer chose for an item in the terminal.
+type reviewDecision struct {
+	Decision string    `json:"decision"`
+	At       time.Time `json:"at"`
+}
+
+// keyReader reads single key presses. On a terminal each key is read in raw
+// mode so no Enter is needed; otherwise the first character of each line is
+// used.
+type keyReader struct {
+	in   *os.File
+	raw  bool
+	line *bufio.Reader
+}
+
+func newKeyReader(in *os.File) *keyReader {
+	return &keyReader{
+		in:   in,
+		raw:  term.IsTerminal(int(in.Fd())),
+		line: bufio.NewReader(in),
+	}
+}
+
+func (kr *keyReader) read() (byte, error) {
+	if !kr.raw {
+		line, err := kr.line.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			if err != nil {
+				return 0, err
+			}
+			return kr.read()
+		}
+		return line[0], nil
+	}
+
+	state, err := term.MakeRaw(int(kr.in.Fd()))
+	if err != nil {
+		return 0, err
+	}
+	defer term.Restore(int(kr.in.Fd()), state)
+
+	var buf [1]byte
+	if _, err := kr.in.Read(buf[:]); err != nil {
+		return 0, err
+	}
+
+	return buf[0], nil
+}
+
+// runReview implements the review subcommand. It walks the comments and posts
+// the rules select, one at a time, and applies the decision made for each
+// with a single key. Decisions are stored right away and reviewed items are
+// not shown again, so a session can be quit and resumed.
+func (ds *DeleteService) runReview(ctx context.Context, in *os.File, out io.Writer) error {
+	keys := newKeyReader(in)
+
+	review := func(t target) (bool, error) {
+		return ds.reviewItem(ctx, t, keys, out)
+	}
+
+	comments := newListingSource(ds.db, "review_comments", ds.client.User.Comments, commentTarget)
+	if err := comments.Walk(ctx, review, nil); err != nil {
+		return reviewErr(fmt.Errorf("review comments: %w", err))
+	}
+
+	posts := newListingSource(ds.db, "review_posts", ds.client.User.Posts, postTarget)
+	if err := posts.Walk(ctx, review, nil); err != nil {
+		return reviewErr(fmt.Errorf("review posts: %w", err))
+	}
+
+	fmt.Fprintln(out, "Nothing left to review.")
+
+	return nil
+}
+
+// reviewErr turns quitting the session into a clean exit.
+func reviewErr(err error) error {
+	if errors.Is(err, errQuit) {
+		return nil
+	}
+
+	return err
+}
+
+// reviewItem shows a target selected by the rules and applies the decision
+// made for it. Targets that are protected, already handled or reviewed
+// before are passed over. It reports whether the target was deleted.
+func (ds *DeleteService) reviewItem(ctx context.Context, t target, keys *keyReader, out io.Writer) (bool, error) {
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	_, protected, err := ds.protected(t)
+	if err != nil || protected {
+		return false, err
+	}
+
+	decision := ds.rules.Evaluate(t.item())
+	if decision.Action != rules.ActionDelete {
+		return false, nil
+	}
+
+	record, err := getRecord(ds.db, t)
+	if err != nil || record.State != stateNone {
+		return false, err
+	}
+
+	reviewed, err := ds.db.Has([]byte(reviewNamespace), retryKey(t))
+	if err != nil || reviewed {
+		return false, err
+	}
+
+	showTarget(out, t, decision, ds.linkBase)
+
+	choice, err := readChoice(keys, out)
+	if err != nil {
+		return false, err
+	}
+
+	if err := ds.applyReview(ctx, t, choice, out); err != nil {
+		return false, err
+	}
+
+	value, err := json.Marshal(reviewDecision{Decision: choice, At: time.Now()})
+	if err != nil {
+		return false, err
+	}
+
+	if err := ds.db.Set([]byte(reviewNamespace), retryKey(t), value); err != nil {
+		return false, err
+	}
+
+	return choice == reviewDelete && !ds.dryRun, nil
+}
+
+// readChoice prompts until a known key is pressed.
+func readChoice(keys *keyReader, out io.Writer) (string, error) {
+	for {
+		fmt.Fprint(out, "[k]eep  [d]elete  [o]verwrite only  [s]kip  keep sub[r]eddit  [q]uit > ")
+
+		key, err := keys.read()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintln(out, string(key))
+
+		// q, Ctrl-C and Ctrl-D end the session.
+		if key == 'q' || key == 3 || key == 4 {
+			return "", errQuit
+		}
+
+		if choice, ok := reviewKeys[key]; ok {
+			return choice, nil
+		}
+	}
+}
+
+// applyReview carries out a decision.
+func (ds *DeleteService) applyReview(ctx context.Context, t target, choice string, out io.Writer) error {
+	switch choice {
+	case reviewKeep:
+		return addKeep(ds.db, t.keepEntry())
+	case reviewKeepSubreddit:
+		return addKeep(ds.db, newKeepEntry(keepSubreddit, t.Subreddit))
+	case reviewDelete:
+		if ds.dryRun {
+			log.WithFields(log.Fields{
+				"kind": t.kind,
+				"id":   t.ID,
+			}).Info("Dry run, not deleting")
+			return nil
+		}
+		fmt.Fprintln(out, ds.execute(ctx, t))
+	case reviewOverwriteOnly:
+		return ds.overwriteOnly(ctx, t)
+	}
+
+	return nil
+}
+
+// overwriteOnly edits the target to replacement text and keeps it, so later
+// runs never delete it.
+func (ds *DeleteService) overwriteOnly(ctx context.Context, t target) error {
+	if !t.editable {
+		return fmt.Errorf("%s %s has no text to overwrite", t.kind, t.ID)
+	}
+
+	if ds.dryRun {
+		log.WithFields(log.Fields{
+			"kind": t.kind,
+			"id":   t.ID,
+		}).Info("Dry run, not overwriting")
+		return nil
+	}
+
+	record, err := getRecord(ds.db, t)
+	if err != nil {
+		return err
+	}
+
+	if err := record.transition(stateSelected, nil); err != nil {
+		return err
+	}
+
+	if record.Archive, err = ds.archive(t); err != nil {
+		return err
+	}
+
+	if err := ds.overwriteTarget(ctx, t, &record); err != nil {
+		return err
+	}
+
+	return addKeep(ds.db, t.keepEntry())
+}
+
+// showTarget prints a target with its context.
+func showTarget(out io.Writer, t target, decision rules.Decision, linkBase string) {
+	fmt.Fprintln(out, strings.Repeat("-", 72))
+	fmt.Fprintf(out, "%s in r/%s, score %d, %s old", t.kind, t.Subreddit, t.Score, formatAge(time.Since(t.Created)))
+	if t.Edited {
+		fmt.Fprint(out, ", edited")
+	}
+	if t.NSFW {
+		fmt.Fprint(out, ", NSFW")
+	}
+	fmt.Fprintln(out)
+
+	if t.Title != "" {
+		fmt.Fprintf(out, "Thread: %s\n", t.Title)
+	}
+	fmt.Fprintf(out, "Link:   %s\n", permalinkURL(linkBase, t.Permalink))
+	fmt.Fprintf(out, "Rule:   %s\n", decision.Rule)
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, t.Body)
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	keepNamespace = "keep"
+
+	keepComment   = "comment"
+	keepThread    = "thread"
+	keepSubreddit = "subreddit"
+)
+
+// keepEntry identifies what a keep-list entry protects: a single comment, a
+// whole thread (the post and every comment on it) or a subreddit.
+type keepEntry struct {
+	Type  string
+	Value string
+}
+
+func (e keepEntry) key() []byte {
+	return []byte(e.Type + ":" + e.Value)
+}
+
+func (e keepEntry) String() string {
+	return e.Type + " " + e.Value
+}
+
+// parseKeepEntry accepts comment IDs and fullnames, post fullnames, permalinks
+// or URLs, r/subreddit names, and the explicit comment:, thread: and
+// subreddit: forms.
+func parseKeepEntry(s string) (keepEntry, error) {
+	s = strings.TrimSpace(s)
+
+	for _, typ := range []string{keepComment, keepThread, keepSubreddit} {
+		if value, ok := strings.CutPrefix(s, typ+":"); ok && value != "" {
+			return newKeepEntry(typ, value), nil
+		}
+	}
+
+	if strings.Contains(s, "/comments/") {
+		return parsePermalink(s)
+	}
+
+	if name, ok := strings.CutPrefix(strings.TrimPrefix(s, "/"), "r/"); ok && name != "" {
+		return newKeepEntry(keepSubreddit, strings.TrimSuffix(name, "/")), nil
+	}
+
+	if id, ok := strings.CutPrefix(s, "t3_"); ok && id != "" {
+		return newKeepEntry(keepThread, id), nil
+	}
+
+	if id, ok := strings.CutPrefix(s, "t1_"); ok && id != "" {
+		return newKeepEntry(keepComment, id), nil
+	}
+
+	if s == "" || strings.ContainsAny(s, "/:") {
+		return keepEntry{}, fmt.Errorf("cannot parse keep entry %q", s)
+	}
+
+	return newKeepEntry(keepComment, s), nil
+}
+
+// parsePermalink turns /r/<sub>/comments/<post>/<slug>/[<comment>] into a
+// comment entry, or a thread entry when no comment ID is present.
+func parsePermalink(s string) (keepEntry, error) {
+	path := s
+	if u, err := url.Parse(s); err == nil && u.Path != "" {
+		path = u.Path
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if part != "comments" || i+1 >= len(parts) {
+			continue
+		}
+
+		if i+3 < len(parts) && parts[i+3] != "" {
+			return newKeepEntry(keepComment, parts[i+3]), nil
+		}
+
+		return newKeepEntry(keepThread, parts[i+1]), nil
+	}
+
+	return keepEntry{}, fmt.Errorf("cannot parse permalink %q", s)
+}
+
+func newKeepEntry(typ, value string) keepEntry {
+	if typ == keepSubreddit {
+		value = strings.ToLower(value)
+	}
+
+	return keepEntry{Type: typ, Value: value}
+}
+
+// keepEntries lists the entries that would protect the target.
+func (t target) keepEntries() []keepEntry {
+	entries := []keepEntry{
+		newKeepEntry(keepSubreddit, t.Subreddit),
+	}
+
+	if t.ThreadID != "" {
+		entries = append(entries, newKeepEntry(keepThread, t.ThreadID))
+	}
+
+	if t.kind == kindComment {
+		entries = append(entries, newKeepEntry(keepComment, t.ID))
+	}
+
+	return entries
+}
+
+// keepEntry returns the entry protecting just the target: the comment itself,
+// or the thread of a post.
+func (t target) keepEntry() keepEntry {
+	if t.kind == kindPost {
+		return newKeepEntry(keepThread, t.ID)
+	}
+
+	return newKeepEntry(keepComment, t.ID)
+}
+
+// protected reports why a target must not be deleted, if it must not.
+func (ds *DeleteService) protected(t target) (string, bool, error) {
+	if ds.keepSaved && t.Saved {
+		return "saved by user", true, nil
+	}
+
+	for _, e := range t.keepEntries() {
+		exists, err := ds.db.Has([]byte(keepNamespace), e.key())
+		if err != nil {
+			return "", false, err
+		}
+
+		if exists {
+			return "keep-list " + e.String(), true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// addKeep stores the entry in the keep-list.
+func addKeep(db badger.DB, e keepEntry) error {
+	return db.Set([]byte(keepNamespace), e.key(), []byte(time.Now().Format(time.RFC3339)))
+}
+
+// runKeep implements the keep subcommand: keep add|remove <entry>... and keep
+// list.
+func runKeep(db badger.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: keep add|remove <entry>... | keep list")
+	}
+
+	switch args[0] {
+	case "add", "remove":
+		for _, arg := range args[1:] {
+			e, err := parseKeepEntry(arg)
+			if err != nil {
+				return err
+			}
+
+			if args[0] == "add" {
+				err = addKeep(db, e)
+			} else {
+				err = db.Delete([]byte(keepNamespace), e.key())
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s %s\n", args[0], e)
+		}
+		return nil
+	case "list":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TYPE\tVALUE\tADDED")
+		err := db.IteratePrefix([]byte(keepNamespace), nil, func(key, value []byte) error {
+			typ, val, _ := strings.Cut(string(key), ":")
+			_, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", typ, val, value)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown keep action %q", args[0])
+	}
+}
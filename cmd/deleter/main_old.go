@@ -2,78 +2,48 @@ package main
 
 import (
 	"context"
-	"time"
+	"flag"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/carfloresf/reddit-bot/config"
 	"github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/metrics"
+	"github.com/carfloresf/reddit-bot/internal/status"
 	log "github.com/sirupsen/logrus"
-	"github.com/vartanbeno/go-reddit/v2/reddit"
 )
 
-// isCommentDeleted checks if a comment is already marked as deleted in the DB.
-func isCommentDeleted(db badger.DB, commentID string) (bool, error) {
-	return db.Has([]byte("deleter"), []byte(commentID))
-}
-
-// markCommentAsDeleted marks the comment as deleted in the DB.
-func markCommentAsDeleted(db badger.DB, commentID string) error {
-	return db.Set([]byte("deleter"), []byte(commentID), []byte("deleted"))
-}
+func main() {
+	dryRun := flag.Bool("dry-run", false, "select comments and posts without changing anything")
+	planPath := flag.String("plan", "", "write the plan as JSON to this file and as a table to the file with .txt appended")
+	executePlan := flag.String("execute-plan", "", "execute a saved plan instead of scanning")
+	daemon := flag.Bool("daemon", false, "keep running and repeat the scan on the configured schedule")
+	accountName := flag.String("account", "", "only handle this account; all configured accounts by default")
+	flag.Parse()
 
-// processComment handles the processing and deletion of a single Reddit comment.
-func processComment(ctx context.Context, comment *reddit.Comment, client *reddit.Client, db badger.DB) {
-	if time.Since(comment.Created.Time) > 24*time.Hour {
-		log.WithFields(log.Fields{
-			"commentID":     comment.ID,
-			"body":          comment.Body,
-			"created":       comment.Created,
-			"postPermalink": comment.PostPermalink,
-		}).Info("Comment eligible for deletion")
-
-		exists, err := isCommentDeleted(db, comment.ID)
-		if err != nil {
-			log.WithFields(log.Fields{
-				"commentID": comment.ID,
-				"error":     err,
-			}).Error("Failed to check if comment exists")
-			return
-		}
-		if !exists {
-			time.Sleep(10 * time.Second)
-			response, err := client.Comment.Delete(ctx, "t1_"+comment.ID)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"commentID": comment.ID,
-					"error":     err,
-				}).Error("Failed to delete comment")
-				return
-			}
-			log.WithFields(log.Fields{
-				"commentID": comment.ID,
-				"response":  response.Response.Status,
-				"rate":      response.Rate,
-			}).Info("Deleted comment successfully")
-
-			err = markCommentAsDeleted(db, comment.ID)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"commentID": comment.ID,
-					"error":     err,
-				}).Error("Failed to mark comment as deleted")
-				return
-			}
-		} else {
-			log.WithField("commentID", comment.ID).Info("Comment already deleted")
-		}
+	cfg, err := config.ReadConfig("config/config.yml")
+	if err != nil {
+		log.Fatal(err)
 	}
-}
 
-func main() {
-	cfg, err := config.ReadConfig("config/config.yml")
+	accounts, err := selectAccounts(cfg, *accountName)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	for i := range accounts {
+		if *dryRun {
+			accounts[i].Deleter.DryRun = true
+		}
+
+		if *daemon {
+			accounts[i].Deleter.Schedule.Daemon = true
+		}
+	}
+
 	log.Infof("Configuration loaded successfully")
 
 	badgerDB, err := badger.NewBadgerDB(cfg.DB.DBFile)
@@ -86,29 +56,172 @@ func main() {
 		}
 	}()
 
-	credentials := reddit.Credentials{
-		ID:       cfg.Reddit.ClientID,
-		Secret:   cfg.Reddit.Secret,
-		Username: cfg.Reddit.Username,
-		Password: cfg.Reddit.Password,
+	single := flag.NArg() > 0 || *executePlan != ""
+	if single && len(accounts) != 1 {
+		log.Fatalf("Select an account with -account")
 	}
-	client, err := reddit.NewClient(credentials)
-	if err != nil {
-		log.Fatalf("Failed to create Reddit client: %s", err)
+
+	if flag.NArg() > 0 && !onlineCommands[flag.Arg(0)] {
+		runCommand(accountDB(badgerDB, accounts[0]), cfg.API, flag.Arg(0), flag.Args()[1:])
+		return
 	}
 
-	ctx := context.Background()
-	comments, _, err := client.User.Comments(ctx, &reddit.ListUserOverviewOptions{
-		ListOptions: reddit.ListOptions{
-			Limit: 1000,
-		},
-		Time: "all",
-	})
-	if err != nil {
-		log.Fatalf("Failed to fetch comments: %s", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if flag.Arg(0) == "authorize" {
+		if err := runAuthorize(ctx, accountDB(badgerDB, accounts[0]), cfg.HTTP, cfg.API, accounts[0].Reddit); err != nil {
+			log.Fatalf("Authorize failed: %s", err)
+		}
+		return
+	}
+
+	services := make([]*DeleteService, len(accounts))
+	for i, account := range accounts {
+		services[i], err = newAccountService(ctx, badgerDB, cfg.HTTP, cfg.API, account)
+		if err != nil {
+			log.Fatalf("Failed to set up account %q: %s", account.Name, err)
+		}
+	}
+
+	switch flag.Arg(0) {
+	case "import":
+		if err := services[0].runImport(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("Import failed: %s", err)
+		}
+		return
+	case "cleanup":
+		if err := services[0].runCleanupCommand(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("Cleanup failed: %s", err)
+		}
+		return
+	case "inbox":
+		if err := services[0].runInboxCommand(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("Inbox cleanup failed: %s", err)
+		}
+		return
+	case "review":
+		if err := services[0].runReview(ctx, os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("Review failed: %s", err)
+		}
+		return
+	case "verify":
+		if err := services[0].verifyDeletions(ctx); err != nil {
+			log.Fatalf("Verification failed: %s", err)
+		}
+		return
 	}
 
-	for _, comment := range comments {
-		processComment(ctx, comment, client, badgerDB)
+	if *executePlan != "" {
+		plan, err := LoadPlan(*executePlan)
+		if err != nil {
+			log.Fatalf("Failed to load plan: %s", err)
+		}
+
+		services[0].executePlan(ctx, plan)
+		return
+	}
+
+	if err := metrics.RegisterDB(badgerDB); err != nil {
+		log.Fatalf("Failed to register database metrics: %s", err)
+	}
+
+	server := status.NewServer(cfg.HTTP.Secret)
+	server.Handle("/metrics", metrics.Handler())
+
+	names := make([]string, len(accounts))
+	for i, account := range accounts {
+		names[i] = account.Name
+		server.Register(account.Name, services[i].Tracker())
+	}
+
+	// Review decisions delete items, so the UI is only served behind the
+	// secret.
+	if server.HasSecret() {
+		review := server.Protect(newReviewHandler(names, services, server.CSRFToken(), cfg.API.RedditOAuthURL))
+		server.Handle("/review", review)
+		server.Handle("/review/", review)
+	} else {
+		log.Warn("No HTTP secret configured, the review UI is disabled")
+	}
+
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		if err := server.ListenAndServe(ctx, net.JoinHostPort(cfg.HTTP.Addr, cfg.HTTP.Port)); err != nil {
+			log.WithField("error", err).Error("Status API failed")
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		account := account
+		deleteService := services[i]
+		path := accountPlanPath(*planPath, account, len(accounts))
+		pass := func(ctx context.Context) error {
+			log.WithField("account", account.Name).Info("Starting run")
+			return deleteService.Run(ctx, path)
+		}
+
+		if !account.Deleter.Schedule.Daemon {
+			if err := pass(ctx); err != nil {
+				log.WithField("account", account.Name).Errorf("Run failed: %s", err)
+			}
+			continue
+		}
+
+		scheduler, err := NewScheduler(accountDB(badgerDB, account), account.Deleter.Schedule, deleteService.Tracker().Triggered(), pass)
+		if err != nil {
+			log.Fatalf("Failed to create scheduler for account %q: %s", account.Name, err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scheduler.Run(ctx)
+		}()
+	}
+
+	wg.Wait()
+
+	// One-shot runs are over at this point; stop the status API with them.
+	stop()
+	<-serverDone
+
+	log.Info("shutting down...")
+}
+
+// onlineCommands are the subcommands that talk to Reddit. All others only work
+// on the local database.
+var onlineCommands = map[string]bool{
+	"authorize": true,
+	"cleanup":   true,
+	"import":    true,
+	"inbox":     true,
+	"review":    true,
+	"verify":    true,
+}
+
+// runCommand runs a subcommand that only works on the local database.
+func runCommand(db badger.DB, api config.API, name string, args []string) {
+	var err error
+
+	switch name {
+	case "approve":
+		err = runApprove(db, api.RedditOAuthURL, args)
+	case "export":
+		err = runExport(db, api.RedditOAuthURL, args)
+	case "keep":
+		err = runKeep(db, args)
+	case "state":
+		err = runState(db, args)
+	case "retry":
+		err = runRetry(db, args)
+	default:
+		log.Fatalf("Unknown command %q", name)
+	}
+
+	if err != nil {
+		log.Fatalf("Command %s failed: %s", name, err)
 	}
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	overwriteModeRandom   = "random"
+	overwriteModeFixed    = "fixed"
+	overwriteModeTemplate = "template"
+)
+
+// overwriteWords is the vocabulary used by the random overwrite mode.
+var overwriteWords = []string{
+	"anchor", "basket", "candle", "desert", "engine", "forest", "garden", "harbor",
+	"island", "jacket", "kettle", "ladder", "meadow", "needle", "orange", "pencil",
+	"quartz", "ribbon", "saddle", "tunnel", "umbrella", "valley", "window", "yellow",
+	"zipper", "bridge", "copper", "dolphin", "feather", "glacier", "hammer", "lantern",
+}
+
+// overwriteData is passed to the template overwrite mode.
+type overwriteData struct {
+	ID        string
+	Subreddit string
+	Created   time.Time
+	Now       time.Time
+	Words     string
+}
+
+// parseOverwriteTemplate validates the overwrite settings and parses the
+// template when the template mode is selected.
+func parseOverwriteTemplate(mode, text string) (*template.Template, error) {
+	switch mode {
+	case overwriteModeRandom:
+		return nil, nil
+	case overwriteModeFixed:
+		if strings.TrimSpace(text) == "" {
+			return nil, fmt.Errorf("overwrite mode %q requires text", mode)
+		}
+		return nil, nil
+	case overwriteModeTemplate:
+		return template.New("overwrite").Parse(text)
+	default:
+		return nil, fmt.Errorf("unknown overwrite mode %q", mode)
+	}
+}
+
+// randomWords returns n space separated words picked from overwriteWords.
+func randomWords(n int) string {
+	if n <= 0 {
+		n = 1
+	}
+
+	words := make([]string, n)
+	for i := range words {
+		words[i] = overwriteWords[rand.Intn(len(overwriteWords))]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// replacementText builds the text a target is edited to before deletion.
+func (ds *DeleteService) replacementText(t target) (string, error) {
+	switch ds.overwrite.Mode {
+	case overwriteModeFixed:
+		return ds.overwrite.Text, nil
+	case overwriteModeTemplate:
+		data := overwriteData{
+			ID:        t.ID,
+			Subreddit: t.Subreddit,
+			Created:   t.Created,
+			Now:       time.Now(),
+			Words:     randomWords(ds.overwrite.Words),
+		}
+
+		var buf bytes.Buffer
+		if err := ds.template.Execute(&buf, data); err != nil {
+			return "", err
+		}
+
+		return buf.String(), nil
+	default:
+		return randomWords(ds.overwrite.Words), nil
+	}
+}
+
+// overwriteTarget edits the target to replacement text and moves it to the
+// overwritten state so the verification can pick it up after a restart.
+func (ds *DeleteService) overwriteTarget(ctx context.Context, t target, record *commentRecord) error {
+	text, err := ds.replacementText(t)
+	if err != nil {
+		return fmt.Errorf("build replacement text: %w", err)
+	}
+
+	if err := ds.edit(ctx, t, text); err != nil {
+		return fmt.Errorf("edit %s: %w", t.kind, err)
+	}
+
+	if err := ds.archiveReplacement(t, text); err != nil {
+		return err
+	}
+
+	record.Replacement = text
+
+	return moveRecord(ds.db, t, record, stateOverwritten, nil)
+}
+
+// verifyOverwrite re-fetches the target and reports whether its body matches
+// the replacement text it was edited to.
+func (ds *DeleteService) verifyOverwrite(ctx context.Context, t target, replacement string) (bool, error) {
+	current, found, err := ds.fetchTarget(ctx, t)
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		return false, fmt.Errorf("%s %s not found", t.kind, t.ID)
+	}
+
+	return strings.TrimSpace(current.Body) == strings.TrimSpace(replacement), nil
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
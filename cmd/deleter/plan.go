@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/carfloresf/reddit-bot/internal/rules"
+)
+
+type (
+	// Plan lists every decision of a run. It is written by dry runs so a
+	// policy can be reviewed, and can be executed later exactly as saved.
+	Plan struct {
+		CreatedAt time.Time   `json:"created_at"`
+		Entries   []PlanEntry `json:"entries"`
+	}
+
+	// PlanEntry is the decision taken for a single comment or post.
+	PlanEntry struct {
+		Kind      string    `json:"kind"`
+		ID        string    `json:"id"`
+		Subreddit string    `json:"subreddit"`
+		Created   time.Time `json:"created"`
+		Age       string    `json:"age"`
+		Score     int       `json:"score"`
+		Rule      string    `json:"rule"`
+		Action    string    `json:"action"`
+		Editable  bool      `json:"editable"`
+	}
+)
+
+func newPlan() *Plan {
+	return &Plan{CreatedAt: time.Now()}
+}
+
+func (p *Plan) add(t target, decision rules.Decision) {
+	p.Entries = append(p.Entries, PlanEntry{
+		Kind:      t.kind,
+		ID:        t.ID,
+		Subreddit: t.Subreddit,
+		Created:   t.Created,
+		Age:       formatAge(time.Since(t.Created)),
+		Score:     t.Score,
+		Rule:      decision.Rule,
+		Action:    decision.Action,
+		Editable:  t.editable,
+	})
+}
+
+// target rebuilds the deleter target the entry was recorded for.
+func (e PlanEntry) target() target {
+	prefix := "t1_"
+	if e.Kind == kindPost {
+		prefix = "t3_"
+	}
+
+	return target{
+		kind:      e.Kind,
+		ID:        e.ID,
+		FullID:    prefix + e.ID,
+		Subreddit: e.Subreddit,
+		Created:   e.Created,
+		Score:     e.Score,
+		editable:  e.Editable,
+	}
+}
+
+// WriteTable writes the plan as an aligned, human-readable table.
+func (p *Plan) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "KIND\tID\tSUBREDDIT\tAGE\tSCORE\tACTION\tRULE")
+	for _, e := range p.Entries {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", e.Kind, e.ID, e.Subreddit, e.Age, e.Score, e.Action, e.Rule)
+	}
+
+	return tw.Flush()
+}
+
+// Save writes the plan as JSON to path and as a table to path with .txt
+// appended, a name that never clashes with the JSON file.
+func (p *Plan) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	table, err := os.Create(path + ".txt")
+	if err != nil {
+		return err
+	}
+
+	if err := p.WriteTable(table); err != nil {
+		table.Close()
+		return err
+	}
+
+	return table.Close()
+}
+
+// LoadPlan reads a plan previously written by Save.
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("plan %s: %w", path, err)
+	}
+
+	return plan, nil
+}
+
+// executePlan deletes exactly the entries the plan selected for deletion,
+// without evaluating the rules again.
+func (ds *DeleteService) executePlan(ctx context.Context, plan *Plan) {
+	log.WithFields(log.Fields{
+		"created": plan.CreatedAt,
+		"entries": len(plan.Entries),
+	}).Info("Executing plan")
+
+	if ds.dryRun {
+		log.Info("Dry run enabled, not executing plan")
+		return
+	}
+
+	summary := newRunSummary(ds.account, ds.tracker)
+	defer summary.log()
+
+	for _, e := range plan.Entries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if e.Action != rules.ActionDelete {
+			continue
+		}
+		summary.scanned()
+
+		// Refetch the full item so it can be archived before it is changed.
+		t, found, err := ds.fetchTarget(ctx, e.target())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"kind":  e.Kind,
+				"id":    e.ID,
+				"error": err,
+			}).Error("Failed to fetch planned item")
+			continue
+		}
+
+		if !found {
+			log.WithFields(log.Fields{
+				"kind": e.Kind,
+				"id":   e.ID,
+			}).Warn("Planned item no longer exists")
+			continue
+		}
+
+		if reason, protected, err := ds.protected(t); err != nil || protected {
+			log.WithFields(log.Fields{
+				"kind":   e.Kind,
+				"id":     e.ID,
+				"reason": reason,
+				"error":  err,
+			}).Warn("Skipping planned item")
+			continue
+		}
+
+		summary.add(ds.execute(ctx, t))
+	}
+}
+
+// formatAge renders an age in whole days, or hours when under a day.
+func formatAge(age time.Duration) string {
+	if age < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+
+	return fmt.Sprintf("%dd", int(age.Hours()/24))
+}
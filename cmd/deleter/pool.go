@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/carfloresf/reddit-bot/internal/metrics"
+	"github.com/carfloresf/reddit-bot/internal/status"
+)
+
+const (
+	orderListing     = "listing"
+	orderOldestFirst = "oldest_first"
+)
+
+// Outcomes of executing a selected target.
+const (
+	outcomeDeleted        = "deleted"
+	outcomeAlreadyDeleted = "already_deleted"
+	outcomeFailed         = "failed"
+	outcomeInterrupted    = "interrupted"
+	outcomeDeferred       = "deferred"
+	outcomeDeadLetter     = "dead_letter"
+)
+
+type (
+	// workerPool executes selected targets on a fixed number of goroutines.
+	// The workers share the client, and with it the single request pacer,
+	// so adding workers never raises the request rate above Reddit's limit.
+	workerPool struct {
+		ctx     context.Context
+		queue   chan target
+		summary *runSummary
+		wg      sync.WaitGroup
+		// inflight counts the targets handed out and not yet executed.
+		inflight sync.WaitGroup
+
+		// pending buffers the targets of a pass when the oldest ones must
+		// go first.
+		oldestFirst bool
+		pending     []target
+	}
+
+	// runSummary counts what happened during a pass, and forwards the
+	// counts to the status tracker and the metrics.
+	runSummary struct {
+		mu       sync.Mutex
+		started  time.Time
+		seen     int
+		outcomes map[string]int
+		account  string
+		tracker  *status.Tracker
+	}
+)
+
+func newRunSummary(account string, tracker *status.Tracker) *runSummary {
+	return &runSummary{
+		started:  time.Now(),
+		outcomes: make(map[string]int),
+		account:  account,
+		tracker:  tracker,
+	}
+}
+
+func (s *runSummary) scanned() {
+	s.mu.Lock()
+	s.seen++
+	s.mu.Unlock()
+
+	s.tracker.Add("scanned", 1)
+}
+
+func (s *runSummary) add(outcome string) {
+	s.mu.Lock()
+	s.outcomes[outcome]++
+	s.mu.Unlock()
+
+	s.tracker.Add(outcome, 1)
+	metrics.Deletions.WithLabelValues(s.account, outcome).Inc()
+}
+
+func (s *runSummary) log() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.WithFields(log.Fields{
+		"scanned":             s.seen,
+		outcomeDeleted:        s.outcomes[outcomeDeleted],
+		outcomeAlreadyDeleted: s.outcomes[outcomeAlreadyDeleted],
+		outcomeFailed:         s.outcomes[outcomeFailed],
+		outcomeInterrupted:    s.outcomes[outcomeInterrupted],
+		outcomeDeferred:       s.outcomes[outcomeDeferred],
+		outcomeDeadLetter:     s.outcomes[outcomeDeadLetter],
+		"duration":            time.Since(s.started).Round(time.Second),
+	}).Info("Run summary")
+}
+
+// startPool starts the configured number of workers.
+func (ds *DeleteService) startPool(ctx context.Context, summary *runSummary) *workerPool {
+	p := &workerPool{
+		ctx:         ctx,
+		queue:       make(chan target),
+		summary:     summary,
+		oldestFirst: ds.order == orderOldestFirst,
+	}
+
+	for i := 0; i < ds.workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for t := range p.queue {
+				if err := ds.tracker.WaitIfPaused(ctx); err != nil {
+					summary.add(outcomeInterrupted)
+				} else {
+					summary.add(ds.execute(ctx, t))
+				}
+				p.inflight.Done()
+			}
+		}()
+	}
+
+	return p
+}
+
+// add queues a selected target, or buffers it when ordering oldest first. It
+// reports whether the target is handed to a worker during the listing walk.
+func (p *workerPool) add(t target) bool {
+	if p.oldestFirst {
+		p.pending = append(p.pending, t)
+		return false
+	}
+
+	p.send(t)
+
+	return true
+}
+
+func (p *workerPool) send(t target) {
+	p.inflight.Add(1)
+
+	select {
+	case p.queue <- t:
+	case <-p.ctx.Done():
+		p.inflight.Done()
+	}
+}
+
+// settle waits until every target handed out so far has been executed.
+func (p *workerPool) settle() {
+	p.inflight.Wait()
+}
+
+// wait hands out any buffered targets oldest first, then waits for the
+// workers to finish.
+func (p *workerPool) wait() {
+	sort.SliceStable(p.pending, func(i, j int) bool {
+		return p.pending[i].Created.Before(p.pending[j].Created)
+	})
+
+	for _, t := range p.pending {
+		if p.ctx.Err() != nil {
+			break
+		}
+		p.send(t)
+	}
+	p.pending = nil
+
+	close(p.queue)
+	p.wg.Wait()
+}
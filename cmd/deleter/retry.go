@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	retryNamespace      = "retry"
+	deadLetterNamespace = "dead_letter"
+
+	errorTransient = "transient"
+	errorPermanent = "permanent"
+)
+
+// permanentLabels are Reddit API error labels that no retry can get past.
+var permanentLabels = map[string]bool{
+	"THREAD_LOCKED":   true,
+	"TOO_OLD":         true,
+	"DELETED_COMMENT": true,
+	"DELETED_LINK":    true,
+	"NOT_AUTHOR":      true,
+}
+
+type (
+	// retryEntry is a failed target waiting for its next attempt.
+	retryEntry struct {
+		Kind        string    `json:"kind"`
+		ID          string    `json:"id"`
+		FullID      string    `json:"full_id"`
+		Attempts    int       `json:"attempts"`
+		NextAttempt time.Time `json:"next_attempt"`
+		LastError   string    `json:"last_error"`
+	}
+
+	// deadLetter is a target given up on, kept for manual review.
+	deadLetter struct {
+		Kind      string    `json:"kind"`
+		ID        string    `json:"id"`
+		FullID    string    `json:"full_id"`
+		Subreddit string    `json:"subreddit"`
+		Permalink string    `json:"permalink"`
+		Attempts  int       `json:"attempts"`
+		Error     string    `json:"error"`
+		Reason    string    `json:"reason"`
+		At        time.Time `json:"at"`
+	}
+)
+
+// retryKey returns the key of a target in the retry and dead-letter namespaces.
+func retryKey(t target) []byte {
+	return []byte(archiveKey(t))
+}
+
+func (e retryEntry) target() target {
+	return target{kind: e.Kind, ID: e.ID, FullID: e.FullID}
+}
+
+// classifyError tells errors that may go away on a later attempt from those
+// that never will, such as 403 answers for locked or archived threads. The
+// reason describes permanent errors.
+func classifyError(err error) (class, reason string) {
+	var rateErr *reddit.RateLimitError
+	if errors.As(err, &rateErr) {
+		return errorTransient, ""
+	}
+
+	var jsonErr *reddit.JSONErrorResponse
+	if errors.As(err, &jsonErr) {
+		for _, apiErr := range jsonErr.JSON.Errors {
+			if permanentLabels[apiErr.Label] {
+				return errorPermanent, strings.ToLower(apiErr.Label)
+			}
+		}
+		if jsonErr.Response != nil {
+			return classifyStatus(jsonErr.Response.StatusCode)
+		}
+	}
+
+	var respErr *reddit.ErrorResponse
+	if errors.As(err, &respErr) && respErr.Response != nil {
+		return classifyStatus(respErr.Response.StatusCode)
+	}
+
+	return errorTransient, ""
+}
+
+func classifyStatus(status int) (class, reason string) {
+	switch {
+	case status == http.StatusForbidden:
+		return errorPermanent, "forbidden, the thread is locked or archived"
+	case status == http.StatusNotFound:
+		return errorPermanent, "not found"
+	case status == http.StatusRequestTimeout || status == http.StatusTooManyRequests:
+		return errorTransient, ""
+	case status == http.StatusUnauthorized:
+		// An expired token or a missing scope fails every item alike and
+		// is fixed outside the item, so it must not dead-letter them.
+		return errorTransient, ""
+	case status >= 400 && status < 500:
+		return errorPermanent, http.StatusText(status)
+	default:
+		return errorTransient, ""
+	}
+}
+
+// retryBackoff returns the wait before the attempt following attempts failed
+// ones.
+func (ds *DeleteService) retryBackoff(attempts int) time.Duration {
+	backoff := ds.retry.Backoff
+	for i := 1; i < attempts && backoff < ds.retry.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, ds.retry.MaxBackoff)
+}
+
+// scheduleRetry queues a failed target for another attempt, or moves it to
+// the dead-letter list when the error is permanent or no attempts are left.
+func (ds *DeleteService) scheduleRetry(t target, record *commentRecord, cause error) error {
+	class, reason := classifyError(cause)
+	if class == errorTransient && record.Attempts >= ds.retry.MaxAttempts {
+		reason = fmt.Sprintf("gave up after %d attempts", record.Attempts)
+	} else if class == errorTransient {
+		entry := retryEntry{
+			Kind:        t.kind,
+			ID:          t.ID,
+			FullID:      t.FullID,
+			Attempts:    record.Attempts,
+			NextAttempt: time.Now().Add(ds.retryBackoff(record.Attempts)),
+			LastError:   cause.Error(),
+		}
+
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"kind":         t.kind,
+			"id":           t.ID,
+			"attempts":     entry.Attempts,
+			"next_attempt": entry.NextAttempt.Format(time.RFC3339),
+		}).Info("Scheduled retry")
+
+		return ds.db.Set([]byte(retryNamespace), retryKey(t), value)
+	}
+
+	letter := deadLetter{
+		Kind:      t.kind,
+		ID:        t.ID,
+		FullID:    t.FullID,
+		Subreddit: t.Subreddit,
+		Permalink: t.Permalink,
+		Attempts:  record.Attempts,
+		Error:     cause.Error(),
+		Reason:    reason,
+		At:        time.Now(),
+	}
+
+	value, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	if err := ds.db.Set([]byte(deadLetterNamespace), retryKey(t), value); err != nil {
+		return err
+	}
+
+	if err := ds.clearRetry(t); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"kind":   t.kind,
+		"id":     t.ID,
+		"reason": reason,
+	}).Warn("Moved to the dead-letter list")
+
+	return moveRecord(ds.db, t, record, stateDeadLetter, nil)
+}
+
+// clearRetry removes a target from the retry queue.
+func (ds *DeleteService) clearRetry(t target) error {
+	return ds.db.Delete([]byte(retryNamespace), retryKey(t))
+}
+
+// retryDue reports whether a failed target may be attempted again. Targets
+// that failed without a queue entry are always due.
+func (ds *DeleteService) retryDue(t target) (bool, error) {
+	value, err := ds.db.Get([]byte(retryNamespace), retryKey(t))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var entry retryEntry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return false, err
+	}
+
+	return !time.Now().Before(entry.NextAttempt), nil
+}
+
+// dueRetries lists the queued targets whose next attempt is due.
+func (ds *DeleteService) dueRetries() ([]retryEntry, error) {
+	now := time.Now()
+
+	var due []retryEntry
+	err := ds.db.IteratePrefix([]byte(retryNamespace), nil, func(_, value []byte) error {
+		var entry retryEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return err
+		}
+
+		if !now.Before(entry.NextAttempt) {
+			due = append(due, entry)
+		}
+		return nil
+	})
+
+	return due, err
+}
+
+// runRetries attempts every queued target that is due, whether or not it
+// still shows up in the listings, and waits for the attempts to finish.
+func (ds *DeleteService) runRetries(ctx context.Context, summary *runSummary) {
+	entries, err := ds.dueRetries()
+	if err != nil {
+		log.WithField("error", err).Error("Failed to read the retry queue")
+		return
+	}
+
+	if len(entries) == 0 {
+		return
+	}
+
+	log.WithField("count", len(entries)).Info("Retrying failed items")
+
+	pool := ds.startPool(ctx, summary)
+	defer pool.wait()
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
+
+		t, found, err := ds.fetchTarget(ctx, entry.target())
+		if err != nil {
+			log.WithFields(log.Fields{
+				"kind":  entry.Kind,
+				"id":    entry.ID,
+				"error": err,
+			}).Error("Failed to fetch retry target")
+			continue
+		}
+
+		if !found || t.gone() {
+			ds.retryGone(entry.target())
+			continue
+		}
+
+		reason, protected, err := ds.protected(t)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"kind":  t.kind,
+				"id":    t.ID,
+				"error": err,
+			}).Error("Failed to check keep-list")
+			continue
+		}
+
+		if protected {
+			log.WithFields(log.Fields{
+				"kind":   t.kind,
+				"id":     t.ID,
+				"reason": reason,
+			}).Info("Retry target is protected now, dropping it")
+			if err := ds.clearRetry(t); err != nil {
+				log.WithFields(log.Fields{
+					"kind":  t.kind,
+					"id":    t.ID,
+					"error": err,
+				}).Error("Failed to drop retry target")
+			}
+			continue
+		}
+
+		pool.add(t)
+	}
+}
+
+// retryGone drops a queued target that no longer exists on Reddit.
+func (ds *DeleteService) retryGone(t target) {
+	log.WithFields(log.Fields{
+		"kind": t.kind,
+		"id":   t.ID,
+	}).Info("Retry target is gone, dropping it")
+
+	record, err := getRecord(ds.db, t)
+	if err == nil && record.State == stateFailed {
+		err = moveRecord(ds.db, t, &record, stateVerifiedGone, nil)
+	}
+	if err == nil {
+		err = ds.clearRetry(t)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to drop retry target")
+	}
+}
+
+// runRetry implements the retry subcommand: retry list shows the queue, retry
+// dead the dead-letter list, and retry requeue|remove <key>... moves entries
+// of the dead-letter list back to the queue or drops them.
+func runRetry(db badger.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: retry list | retry dead | retry requeue|remove <key>...")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	switch args[0] {
+	case "list":
+		fmt.Fprintln(tw, "KEY\tATTEMPTS\tNEXT ATTEMPT\tLAST ERROR")
+		err := db.IteratePrefix([]byte(retryNamespace), nil, func(key, value []byte) error {
+			var entry retryEntry
+			if err := json.Unmarshal(value, &entry); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n",
+				key, entry.Attempts, entry.NextAttempt.Format(time.RFC3339), entry.LastError)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return tw.Flush()
+	case "dead":
+		fmt.Fprintln(tw, "KEY\tSUBREDDIT\tATTEMPTS\tREASON\tERROR")
+		err := db.IteratePrefix([]byte(deadLetterNamespace), nil, func(key, value []byte) error {
+			var letter deadLetter
+			if err := json.Unmarshal(value, &letter); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+				key, letter.Subreddit, letter.Attempts, letter.Reason, letter.Error)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		return tw.Flush()
+	case "requeue", "remove":
+		for _, key := range args[1:] {
+			var err error
+			if args[0] == "requeue" {
+				err = requeueDeadLetter(db, key)
+			} else {
+				err = db.Delete([]byte(deadLetterNamespace), []byte(key))
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("%s %s\n", args[0], key)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown retry action %q", args[0])
+	}
+}
+
+// requeueDeadLetter puts a dead-letter entry back on the retry queue, due
+// right away, with a fresh budget of attempts.
+func requeueDeadLetter(db badger.DB, key string) error {
+	value, err := db.Get([]byte(deadLetterNamespace), []byte(key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return fmt.Errorf("%s is not on the dead-letter list", key)
+	}
+	if err != nil {
+		return err
+	}
+
+	var letter deadLetter
+	if err := json.Unmarshal(value, &letter); err != nil {
+		return err
+	}
+
+	t := target{kind: letter.Kind, ID: letter.ID, FullID: letter.FullID}
+	record, err := getRecord(db, t)
+	if err != nil {
+		return err
+	}
+
+	// Attempts count against the retry budget; without a reset the next
+	// failure would send the item straight back to the dead-letter list.
+	record.Attempts = 0
+	if record.State == stateDeadLetter {
+		err = moveRecord(db, t, &record, stateFailed, nil)
+	} else {
+		err = setRecord(db, t, record)
+	}
+	if err != nil {
+		return err
+	}
+
+	entry, err := json.Marshal(retryEntry{
+		Kind:        letter.Kind,
+		ID:          letter.ID,
+		FullID:      letter.FullID,
+		NextAttempt: time.Now(),
+		LastError:   letter.Error,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := db.Set([]byte(retryNamespace), []byte(key), entry); err != nil {
+		return err
+	}
+
+	return db.Delete([]byte(deadLetterNamespace), []byte(key))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//go:embed templates/review.html
+var reviewFS embed.FS
+
+var reviewTemplate = template.Must(template.ParseFS(reviewFS, "templates/review.html"))
+
+// reviewHandler serves the web UI listing the items held for approval:
+//
+//	GET  /review              the pending items of every account
+//	POST /review/decide       approve or reject one item
+//	POST /review/approve-all  approve every pending item of an account
+//
+// Rejected items are added to the keep-list.
+// The forms carry the CSRF token of the status server serving the UI; items
+// link to the Reddit host at linkBase.
+type reviewHandler struct {
+	accounts  []string
+	services  map[string]*DeleteService
+	csrfToken string
+	linkBase  string
+}
+
+type reviewPage struct {
+	CSRFToken string
+	LinkBase  string
+	Accounts  []reviewAccount
+}
+
+type reviewAccount struct {
+	Account string
+	Items   []approvalItem
+}
+
+func newReviewHandler(accounts []string, services []*DeleteService, csrfToken, linkBase string) http.Handler {
+	h := &reviewHandler{
+		accounts:  accounts,
+		services:  make(map[string]*DeleteService, len(services)),
+		csrfToken: csrfToken,
+		linkBase:  strings.TrimSuffix(linkBase, "/"),
+	}
+	for i, name := range accounts {
+		h.services[name] = services[i]
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/review", h.list)
+	mux.HandleFunc("/review/decide", h.decide)
+	mux.HandleFunc("/review/approve-all", h.approveAll)
+
+	return mux
+}
+
+func (h *reviewHandler) list(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page := reviewPage{CSRFToken: h.csrfToken, LinkBase: h.linkBase, Accounts: make([]reviewAccount, 0, len(h.accounts))}
+	for _, name := range h.accounts {
+		items, err := approvals(h.services[name].db, approvalPending)
+		if err != nil {
+			log.WithField("error", err).Error("Failed to list approvals")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page.Accounts = append(page.Accounts, reviewAccount{Account: name, Items: items})
+	}
+
+	if err := reviewTemplate.Execute(w, page); err != nil {
+		log.WithField("error", err).Error("Failed to render review page")
+	}
+}
+
+func (h *reviewHandler) decide(w http.ResponseWriter, r *http.Request) {
+	ds, ok := h.service(w, r)
+	if !ok {
+		return
+	}
+
+	key := r.PostForm.Get("key")
+
+	var err error
+	switch action := r.PostForm.Get("action"); action {
+	case "approve":
+		err = approve(ds.db, key)
+	case "reject":
+		err = reject(ds.db, key)
+	default:
+		http.Error(w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"account": ds.account,
+		"key":     key,
+		"action":  r.PostForm.Get("action"),
+	}).Info("Reviewed pending deletion")
+
+	http.Redirect(w, r, "/review", http.StatusSeeOther)
+}
+
+func (h *reviewHandler) approveAll(w http.ResponseWriter, r *http.Request) {
+	ds, ok := h.service(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := approveAll(ds.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"account": ds.account,
+		"count":   count,
+	}).Info("Approved all pending deletions")
+
+	http.Redirect(w, r, "/review", http.StatusSeeOther)
+}
+
+// service parses a POST form and returns the service of its account.
+func (h *reviewHandler) service(w http.ResponseWriter, r *http.Request) (*DeleteService, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	ds, ok := h.services[r.PostForm.Get("account")]
+	if !ok {
+		http.Error(w, "unknown account", http.StatusNotFound)
+		return nil, false
+	}
+
+	return ds, true
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/carfloresf/reddit-bot/config"
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	schedulerNamespace = "scheduler"
+	lastRunKey         = "last_run"
+)
+
+// Scheduler repeats a pass on an interval or cron schedule, or right away when
+// triggered. The time of the last completed pass is stored in badger so a
+// restart does not rescan too soon.
+type Scheduler struct {
+	db       badger.DB
+	interval time.Duration
+	cron     cron.Schedule
+	jitter   time.Duration
+	trigger  <-chan struct{}
+	pass     func(ctx context.Context) error
+}
+
+func NewScheduler(db badger.DB, cfg config.Schedule, trigger <-chan struct{}, pass func(ctx context.Context) error) (*Scheduler, error) {
+	s := &Scheduler{
+		db:       db,
+		interval: cfg.Interval,
+		jitter:   cfg.Jitter,
+		trigger:  trigger,
+		pass:     pass,
+	}
+
+	if cfg.Cron != "" {
+		schedule, err := cron.ParseStandard(cfg.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", cfg.Cron, err)
+		}
+		s.cron = schedule
+	} else if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("schedule needs a positive interval or a cron expression")
+	}
+
+	return s, nil
+}
+
+// Run waits for each scheduled time and runs a pass, until ctx is done. A pass
+// interrupted by ctx is not recorded, so the next start resumes it right away.
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		next := s.next(s.lastRun())
+		if s.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+		}
+
+		log.WithField("next", next.Format(time.RFC3339)).Info("Waiting for next run")
+		if err := s.wait(ctx, time.Until(next)); err != nil {
+			return
+		}
+
+		log.Info("Starting scheduled run")
+		err := s.pass(ctx)
+		if ctx.Err() != nil {
+			log.Info("Run interrupted, it will resume on the next start")
+			return
+		}
+
+		if err != nil {
+			log.WithField("error", err).Error("Scheduled run failed")
+		}
+
+		if err := s.setLastRun(time.Now()); err != nil {
+			log.WithField("error", err).Error("Failed to store last run time")
+		}
+	}
+}
+
+// wait sleeps for d, returning early when a run is triggered. It returns an
+// error once ctx is done.
+func (s *Scheduler) wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-s.trigger:
+		log.Info("Run triggered")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// next returns when the pass after one completed at last is due. A zero last
+// run is due immediately.
+func (s *Scheduler) next(last time.Time) time.Time {
+	if last.IsZero() {
+		return time.Now()
+	}
+
+	if s.cron != nil {
+		return s.cron.Next(last)
+	}
+
+	return last.Add(s.interval)
+}
+
+func (s *Scheduler) lastRun() time.Time {
+	value, err := s.db.Get([]byte(schedulerNamespace), []byte(lastRunKey))
+	if err != nil {
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			log.WithField("error", err).Error("Failed to read last run time")
+		}
+		return time.Time{}
+	}
+
+	last, err := time.Parse(time.RFC3339, string(value))
+	if err != nil {
+		log.WithField("error", err).Error("Failed to parse last run time")
+		return time.Time{}
+	}
+
+	return last
+}
+
+func (s *Scheduler) setLastRun(t time.Time) error {
+	return s.db.Set([]byte(schedulerNamespace), []byte(lastRunKey), []byte(t.Format(time.RFC3339)))
+}
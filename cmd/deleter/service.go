@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+
+	"github.com/carfloresf/reddit-bot/config"
+	"github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/rules"
+	"github.com/carfloresf/reddit-bot/internal/status"
+)
+
+// DeleteService overwrites and deletes comments and submissions, recording
+// every step in badger so an interrupted run picks up where it left off.
+type DeleteService struct {
+	client    *reddit.Client
+	db        badger.DB
+	account   string
+	overwrite config.Overwrite
+	template  *template.Template
+	rules     *rules.Engine
+	dryRun    bool
+	keepSaved bool
+	approval  bool
+	workers   int
+	order     string
+	retry     config.Retry
+	cleanup   []string
+
+	// inboxRules select the private messages to delete; inbox clears them
+	// after each pass.
+	inboxRules *rules.Engine
+	inbox      bool
+
+	// linkBase is the Reddit host links shown to the user point at.
+	linkBase string
+
+	// plan, when set, collects every decision so it can be reviewed or saved.
+	plan *Plan
+
+	// tracker reports the run state to the status API and carries its
+	// pause and resume requests.
+	tracker *status.Tracker
+}
+
+func NewDeleteService(client *reddit.Client, db badger.DB, account string, cfg config.Deleter) (*DeleteService, error) {
+	tmpl, err := parseOverwriteTemplate(cfg.Overwrite.Mode, cfg.Overwrite.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleList := cfg.Rules
+	if len(ruleList) == 0 {
+		ruleList = rules.Default
+	}
+
+	engine, err := rules.New(ruleList)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Order != orderListing && cfg.Order != orderOldestFirst {
+		return nil, fmt.Errorf("unknown order %q", cfg.Order)
+	}
+
+	if err := validateCleanup(cfg.Cleanup); err != nil {
+		return nil, err
+	}
+
+	var inboxRules *rules.Engine
+	if len(cfg.Inbox.Rules) > 0 {
+		if inboxRules, err = rules.New(cfg.Inbox.Rules); err != nil {
+			return nil, fmt.Errorf("inbox: %w", err)
+		}
+	} else if cfg.Inbox.Enabled {
+		return nil, errors.New("inbox cleanup needs inbox rules")
+	}
+
+	return &DeleteService{
+		client:     client,
+		db:         db,
+		account:    account,
+		overwrite:  cfg.Overwrite,
+		template:   tmpl,
+		rules:      engine,
+		dryRun:     cfg.DryRun,
+		keepSaved:  cfg.KeepSaved,
+		approval:   cfg.RequireApproval,
+		workers:    max(cfg.Workers, 1),
+		order:      cfg.Order,
+		retry:      cfg.Retry,
+		cleanup:    cfg.Cleanup,
+		inboxRules: inboxRules,
+		inbox:      cfg.Inbox.Enabled,
+		tracker:    status.NewTracker(),
+	}, nil
+}
+
+// Tracker returns the status tracker of the service.
+func (ds *DeleteService) Tracker() *status.Tracker {
+	return ds.tracker
+}
+
+// Run performs a single pass over the user's comments and submissions.
+// Selected items are handed to a pool of workers, in listing order or oldest
+// first, and the deletions are verified once the pass is done. The configured
+// saved and vote listings are cleaned up after that. If planPath is set, or in
+// dry-run mode, the decisions of the pass are collected into a plan that is
+// saved to planPath or printed. Private messages are deleted last when the
+// inbox cleanup is enabled.
+func (ds *DeleteService) Run(ctx context.Context, planPath string) error {
+	ds.tracker.StartRun()
+	err := ds.run(ctx, planPath)
+	ds.tracker.FinishRun(err)
+
+	return err
+}
+
+func (ds *DeleteService) run(ctx context.Context, planPath string) error {
+	ds.plan = nil
+	if ds.dryRun || planPath != "" {
+		ds.plan = newPlan()
+	}
+
+	summary := newRunSummary(ds.account, ds.tracker)
+
+	// Due retries go first, so a target failing again is scheduled before
+	// the listings come across it.
+	if !ds.dryRun {
+		ds.runRetries(ctx, summary)
+		ds.runApproved(ctx, summary)
+	}
+
+	pool := ds.startPool(ctx, summary)
+
+	// Every page is settled before the next is requested, so the listing
+	// no longer holds the items the workers removed from it.
+	selected := func(t target) (bool, error) {
+		summary.scanned()
+		if ds.decide(t) && !ds.dryRun {
+			return pool.add(t), nil
+		}
+		return false, nil
+	}
+
+	var err error
+	comments := newCommentSource(ds.client, ds.db, ds.dryRun)
+	if err = comments.Walk(ctx, selected, pool.settle); err != nil {
+		err = fmt.Errorf("fetch comments: %w", err)
+	} else {
+		posts := newPostSource(ds.client, ds.db, ds.dryRun)
+		if err = posts.Walk(ctx, selected, pool.settle); err != nil {
+			err = fmt.Errorf("fetch posts: %w", err)
+		}
+	}
+
+	pool.wait()
+
+	if !ds.dryRun && ctx.Err() == nil {
+		if verifyErr := ds.verifyDeletions(ctx); verifyErr != nil {
+			log.WithField("error", verifyErr).Error("Failed to verify deletions")
+		}
+	}
+
+	summary.log()
+
+	if err != nil {
+		return err
+	}
+
+	for _, name := range ds.cleanup {
+		if err := ds.runCleanup(ctx, name); err != nil {
+			return fmt.Errorf("clean up %s: %w", name, err)
+		}
+	}
+
+	if ds.inbox {
+		if err := ds.runInbox(ctx, inboxFolders); err != nil {
+			return fmt.Errorf("clean up inbox: %w", err)
+		}
+	}
+
+	if ds.plan == nil {
+		return nil
+	}
+
+	if planPath == "" {
+		return ds.plan.WriteTable(os.Stdout)
+	}
+
+	if err := ds.plan.Save(planPath); err != nil {
+		return fmt.Errorf("save plan: %w", err)
+	}
+	log.WithField("path", planPath).Info("Plan saved")
+
+	return nil
+}
+
+// processComment handles the processing and deletion of a single Reddit comment.
+func (ds *DeleteService) processComment(ctx context.Context, comment *reddit.Comment) {
+	ds.process(ctx, commentTarget(comment))
+}
+
+// processPost handles the processing and deletion of a single submission.
+func (ds *DeleteService) processPost(ctx context.Context, post *reddit.Post) {
+	ds.process(ctx, postTarget(post))
+}
+
+// process applies the retention rules to a target and, if it is selected,
+// overwrites and deletes it. In dry-run mode the decision is only recorded.
+func (ds *DeleteService) process(ctx context.Context, t target) {
+	if ds.decide(t) && !ds.dryRun {
+		ds.execute(ctx, t)
+	}
+}
+
+// decide checks the keep-list and the retention rules, records the decision in
+// the plan if one is being collected, and reports whether the target is
+// selected for deletion. When approval is required, a selected target only
+// goes ahead once a reviewer approved it.
+func (ds *DeleteService) decide(t target) bool {
+	reason, protected, err := ds.protected(t)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to check keep-list")
+		return false
+	}
+
+	decision := ds.rules.Evaluate(t.item())
+	if protected {
+		decision = rules.Decision{Action: rules.ActionKeep, Rule: reason}
+	}
+
+	log.WithFields(log.Fields{
+		"kind":      t.kind,
+		"id":        t.ID,
+		"subreddit": t.Subreddit,
+		"rule":      decision.Rule,
+		"action":    decision.Action,
+	}).Info("Rule decided action")
+
+	if ds.plan != nil {
+		ds.plan.add(t, decision)
+	}
+
+	if decision.Action != rules.ActionDelete {
+		return false
+	}
+
+	if ds.approval && !ds.dryRun {
+		return ds.approved(t, decision)
+	}
+
+	return true
+}
+
+// execute overwrites and deletes a selected target, resuming from its recorded
+// state, and reports the outcome.
+func (ds *DeleteService) execute(ctx context.Context, t target) string {
+	log.WithFields(log.Fields{
+		"kind":      t.kind,
+		"id":        t.ID,
+		"body":      t.Body,
+		"created":   t.Created,
+		"permalink": t.Permalink,
+	}).Info("Eligible for deletion")
+
+	record, err := getRecord(ds.db, t)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to read state")
+		return outcomeFailed
+	}
+
+	if record.done() {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"state": record.State,
+		}).Info("Already deleted")
+		return outcomeAlreadyDeleted
+	}
+
+	switch record.State {
+	case stateDeadLetter:
+		log.WithFields(log.Fields{
+			"kind": t.kind,
+			"id":   t.ID,
+		}).Info("On the dead-letter list, skipping")
+		return outcomeDeadLetter
+	case stateFailed:
+		due, err := ds.retryDue(t)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"kind":  t.kind,
+				"id":    t.ID,
+				"error": err,
+			}).Error("Failed to read the retry queue")
+			return outcomeFailed
+		}
+		if !due {
+			return outcomeDeferred
+		}
+	}
+
+	if record.State == stateNone || record.State == stateFailed {
+		if err := record.transition(stateSelected, nil); err != nil {
+			return ds.fail(t, &record, "Failed to select", err)
+		}
+	}
+
+	if record.Archive == "" {
+		record.Archive, err = ds.archive(t)
+		if err != nil {
+			return ds.fail(t, &record, "Failed to archive", err)
+		}
+	}
+
+	if err := setRecord(ds.db, t, record); err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to record selection")
+		return outcomeFailed
+	}
+
+	if ds.overwrite.Enabled && t.editable {
+		if err := ds.overwriteDone(ctx, t, &record); err != nil {
+			if ctx.Err() != nil {
+				return outcomeInterrupted
+			}
+			return ds.fail(t, &record, "Failed to overwrite", err)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return outcomeInterrupted
+	}
+
+	response, err := ds.remove(ctx, t)
+	if err != nil {
+		if ctx.Err() != nil {
+			return outcomeInterrupted
+		}
+		return ds.fail(t, &record, "Failed to delete", err)
+	}
+	log.WithFields(log.Fields{
+		"kind":     t.kind,
+		"id":       t.ID,
+		"response": response.Response.Status,
+		"rate":     response.Rate,
+	}).Info("Deleted successfully")
+
+	err = moveRecord(ds.db, t, &record, stateDeleteRequested, nil)
+	if err == nil {
+		err = ds.clearRetry(t)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to mark as deleted")
+	}
+
+	return outcomeDeleted
+}
+
+// fail logs why a target could not be processed, moves it to the failed state,
+// schedules a retry and returns the failed outcome.
+func (ds *DeleteService) fail(t target, record *commentRecord, message string, cause error) string {
+	log.WithFields(log.Fields{
+		"kind":  t.kind,
+		"id":    t.ID,
+		"state": record.State,
+		"error": cause,
+	}).Error(message)
+	ds.tracker.Error(fmt.Errorf("%s %s: %w", t.kind, t.ID, cause))
+
+	err := moveRecord(ds.db, t, record, stateFailed, cause)
+	if err == nil {
+		err = ds.scheduleRetry(t, record, cause)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"kind":  t.kind,
+			"id":    t.ID,
+			"error": err,
+		}).Error("Failed to record failure")
+	}
+
+	return outcomeFailed
+}
+
+// overwriteDone drives a target through the overwrite and verification states,
+// resuming from the recorded state. It returns nil once the target is safe to
+// delete.
+func (ds *DeleteService) overwriteDone(ctx context.Context, t target, record *commentRecord) error {
+	if record.State == stateOverwriteVerified {
+		return nil
+	}
+
+	if record.State == stateSelected {
+		if err := ds.overwriteTarget(ctx, t, record); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"kind": t.kind,
+			"id":   t.ID,
+		}).Info("Overwrote text")
+
+		if err := sleepContext(ctx, ds.overwrite.Wait); err != nil {
+			return err
+		}
+	}
+
+	ok, err := ds.verifyOverwrite(ctx, t, record.Replacement)
+	if err != nil {
+		return fmt.Errorf("verify overwrite: %w", err)
+	}
+
+	if !ok {
+		return errors.New("overwrite did not take, will retry on the next run")
+	}
+
+	return moveRecord(ds.db, t, record, stateOverwriteVerified, nil)
+}
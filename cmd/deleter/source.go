@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	cursorNamespace = "cursor"
+
+	// listingPageSize is the largest page the Reddit listing endpoints return.
+	listingPageSize = 100
+)
+
+// listFunc fetches a single page of a user listing.
+type listFunc[T any] func(ctx context.Context, opts *reddit.ListUserOverviewOptions) ([]T, *reddit.Response, error)
+
+// listingSource walks every page of a user listing. The cursor of the page
+// being handled is stored in badger, so an interrupted run refetches that
+// page instead of starting from the top.
+type listingSource struct {
+	db    badger.DB
+	name  string
+	fetch func(ctx context.Context, opts *reddit.ListUserOverviewOptions) ([]target, *reddit.Response, error)
+}
+
+func newListingSource[T any](db badger.DB, name string, list listFunc[T], toTarget func(T) target) *listingSource {
+	return &listingSource{
+		db:   db,
+		name: name,
+		fetch: func(ctx context.Context, opts *reddit.ListUserOverviewOptions) ([]target, *reddit.Response, error) {
+			items, response, err := list(ctx, opts)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			targets := make([]target, len(items))
+			for i, item := range items {
+				targets[i] = toTarget(item)
+			}
+
+			return targets, response, nil
+		},
+	}
+}
+
+// newCommentSource returns a source over all comments of the authenticated user.
+func newCommentSource(client *reddit.Client, db badger.DB, dryRun bool) *listingSource {
+	return newListingSource(db, cursorName("comments", dryRun), client.User.Comments, commentTarget)
+}
+
+// newPostSource returns a source over all submissions of the authenticated user.
+func newPostSource(client *reddit.Client, db badger.DB, dryRun bool) *listingSource {
+	return newListingSource(db, cursorName("posts", dryRun), client.User.Posts, postTarget)
+}
+
+// cursorName keeps dry runs from moving the cursor real runs resume from.
+func cursorName(listing string, dryRun bool) string {
+	if dryRun {
+		return "dry_run_" + listing
+	}
+
+	return listing
+}
+
+// Walk calls handle for every item of the listing until it runs out, handle
+// fails or ctx is done. handle reports whether the item leaves the listing;
+// settle, if not nil, is called after every page and returns once the
+// removals of the page are done.
+//
+// Reddit drops removed items out of the listing and answers a cursor pointing
+// at one with an empty page, so each page is requested after the last item
+// left in place rather than after the last item returned. An item handed out
+// again is evidently still listed, for instance because deleting it failed;
+// it is passed over and serves as the cursor instead.
+func (ls *listingSource) Walk(ctx context.Context, handle func(t target) (bool, error), settle func()) error {
+	after, err := ls.cursor()
+	if err != nil {
+		return err
+	}
+
+	if after != "" {
+		log.WithFields(log.Fields{
+			"listing": ls.name,
+			"after":   after,
+		}).Info("Resuming listing from stored cursor")
+	}
+
+	seen := make(map[string]bool)
+	for {
+		if err := ls.setCursor(after); err != nil {
+			return err
+		}
+
+		items, response, err := ls.fetch(ctx, &reddit.ListUserOverviewOptions{
+			ListOptions: reddit.ListOptions{
+				Limit: listingPageSize,
+				After: after,
+			},
+			Time: "all",
+		})
+		if err != nil {
+			return err
+		}
+
+		lastKept := ""
+		for _, t := range items {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if seen[t.FullID] {
+				lastKept = t.FullID
+				continue
+			}
+			seen[t.FullID] = true
+
+			removed, err := handle(t)
+			if err != nil {
+				return err
+			}
+			if !removed {
+				lastKept = t.FullID
+			}
+		}
+
+		if settle != nil {
+			settle()
+		}
+
+		if len(items) == 0 || response.After == "" {
+			log.WithField("listing", ls.name).Info("Reached the end of the listing")
+			return ls.clearCursor()
+		}
+
+		if lastKept != "" {
+			after = lastKept
+		}
+	}
+}
+
+func (ls *listingSource) cursor() (string, error) {
+	value, err := ls.db.Get([]byte(cursorNamespace), []byte(ls.name))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", nil
+	}
+
+	return string(value), err
+}
+
+func (ls *listingSource) setCursor(after string) error {
+	if after == "" {
+		return nil
+	}
+
+	return ls.db.Set([]byte(cursorNamespace), []byte(ls.name), []byte(after))
+}
+
+func (ls *listingSource) clearCursor() error {
+	return ls.db.Delete([]byte(cursorNamespace), []byte(ls.name))
+}
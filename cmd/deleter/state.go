@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	deleterNamespace = "deleter"
+
+	// legacyDeletedValue is the raw marker written before states were recorded.
+	legacyDeletedValue = "deleted"
+)
+
+// States of a comment or post on its way to deletion. The zero value means
+// nothing has been done yet.
+const (
+	stateNone              = ""
+	stateSelected          = "selected"
+	stateOverwritten       = "overwritten"
+	stateOverwriteVerified = "overwrite_verified"
+	stateDeleteRequested   = "delete_requested"
+	stateVerifiedGone      = "verified_gone"
+	stateFailed            = "failed"
+	stateDeadLetter        = "dead_letter"
+)
+
+// states lists every state in lifecycle order.
+var states = []string{
+	stateSelected,
+	stateOverwritten,
+	stateOverwriteVerified,
+	stateDeleteRequested,
+	stateVerifiedGone,
+	stateFailed,
+	stateDeadLetter,
+}
+
+// transitions lists the states each state may move to. Any state but the
+// final one may fail. A failed target starts over once it is selected again,
+// is found gone, or gives up on the dead-letter list, from where it can be
+// requeued by hand.
+var transitions = map[string][]string{
+	stateNone:              {stateSelected},
+	stateSelected:          {stateOverwritten, stateDeleteRequested, stateFailed},
+	stateOverwritten:       {stateOverwriteVerified, stateDeleteRequested, stateFailed},
+	stateOverwriteVerified: {stateDeleteRequested, stateFailed},
+	stateDeleteRequested:   {stateVerifiedGone, stateFailed},
+	stateFailed:            {stateSelected, stateVerifiedGone, stateDeadLetter},
+	stateDeadLetter:        {stateFailed},
+	stateVerifiedGone:      {},
+}
+
+// legacySteps maps the steps recorded by earlier versions to states.
+var legacySteps = map[string]string{
+	"overwritten": stateOverwritten,
+	"verified":    stateOverwriteVerified,
+	"deleted":     stateDeleteRequested,
+}
+
+// commentRecord is the value stored for a comment in the deleter namespace,
+// and for a post in the posts namespace.
+type commentRecord struct {
+	State     string `json:"state"`
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+
+	// Entered holds when the target last entered each state.
+	Entered   map[string]time.Time `json:"entered,omitempty"`
+	UpdatedAt time.Time            `json:"updated_at"`
+
+	Replacement string `json:"replacement,omitempty"`
+
+	// Archive is the namespaced key of the copy saved before any change.
+	Archive string `json:"archive,omitempty"`
+
+	// Step is only read from records written before states existed.
+	Step string `json:"step,omitempty"`
+}
+
+// done reports whether the delete call has already succeeded.
+func (r commentRecord) done() bool {
+	return r.State == stateDeleteRequested || r.State == stateVerifiedGone
+}
+
+// transition moves the record to a new state. cause is recorded as the last
+// error when moving to the failed state.
+func (r *commentRecord) transition(to string, cause error) error {
+	allowed := false
+	for _, next := range transitions[r.State] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("invalid state transition from %q to %q", r.State, to)
+	}
+
+	now := time.Now()
+	if r.Entered == nil {
+		r.Entered = make(map[string]time.Time)
+	}
+	r.Entered[to] = now
+	r.State = to
+
+	switch to {
+	case stateSelected:
+		r.Attempts++
+	case stateFailed:
+		if cause != nil {
+			r.LastError = cause.Error()
+		}
+	}
+
+	return nil
+}
+
+// decodeRecord parses a stored record, upgrading the legacy formats.
+func decodeRecord(value []byte) (commentRecord, error) {
+	if string(value) == legacyDeletedValue {
+		return commentRecord{State: stateDeleteRequested}, nil
+	}
+
+	var record commentRecord
+	if err := json.Unmarshal(value, &record); err != nil {
+		return commentRecord{}, err
+	}
+
+	if record.State == stateNone && record.Step != "" {
+		record.State = legacySteps[record.Step]
+	}
+	record.Step = ""
+
+	return record, nil
+}
+
+// getRecord returns the stored record for a target, or an empty record if the
+// target has not been touched yet.
+func getRecord(db badger.DB, t target) (commentRecord, error) {
+	value, err := db.Get([]byte(t.namespace()), []byte(t.ID))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return commentRecord{}, nil
+	}
+	if err != nil {
+		return commentRecord{}, err
+	}
+
+	return decodeRecord(value)
+}
+
+// setRecord stores the record for a target, stamping the update time.
+func setRecord(db badger.DB, t target, record commentRecord) error {
+	record.UpdatedAt = time.Now()
+
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return db.Set([]byte(t.namespace()), []byte(t.ID), value)
+}
+
+// moveRecord transitions the record of a target and stores it.
+func moveRecord(db badger.DB, t target, record *commentRecord, to string, cause error) error {
+	if err := record.transition(to, cause); err != nil {
+		return err
+	}
+
+	return setRecord(db, t, *record)
+}
+
+// runState implements the state subcommand, listing the recorded comments,
+// posts and messages, optionally only those in one state.
+func runState(db badger.DB, args []string) error {
+	fs := flag.NewFlagSet("state", flag.ContinueOnError)
+	state := fs.String("state", "", "only list items in this state")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *state != "" && !validState(*state) {
+		return fmt.Errorf("unknown state %q, expected one of %v", *state, states)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tID\tSTATE\tATTEMPTS\tUPDATED\tLAST ERROR")
+
+	counts := make(map[string]int)
+	for _, kind := range []string{kindComment, kindPost, kindMessage} {
+		namespace := target{kind: kind}.namespace()
+		err := db.IteratePrefix([]byte(namespace), nil, func(key, value []byte) error {
+			record, err := decodeRecord(value)
+			if err != nil {
+				return fmt.Errorf("decode %s %s: %w", kind, key, err)
+			}
+
+			counts[record.State]++
+			if *state != "" && record.State != *state {
+				return nil
+			}
+
+			updated := ""
+			if !record.UpdatedAt.IsZero() {
+				updated = record.UpdatedAt.Format(time.RFC3339)
+			}
+
+			_, err = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				kind, key, record.State, record.Attempts, updated, record.LastError)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println()
+	for _, name := range names {
+		fmt.Printf("%s: %d\n", name, counts[name])
+	}
+
+	return nil
+}
+
+func validState(s string) bool {
+	for _, state := range states {
+		if state == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/vartanbeno/go-reddit/v2/reddit"
+
+	"github.com/carfloresf/reddit-bot/internal/rules"
+)
+
+const (
+	kindComment = "comment"
+	kindPost    = "post"
+
+	postsNamespace = "deleter_posts"
+)
+
+// target is a comment or a submission the deleter acts on. Both go through
+// the same rules, overwrite and delete steps; only the endpoints and the
+// badger namespace differ. Private messages are targets too, but only their
+// state is tracked the same way.
+type target struct {
+	kind      string
+	ID        string
+	FullID    string
+	Subreddit string
+	Title     string
+	Body      string
+	Permalink string
+	Created   time.Time
+	Edited    bool
+	Score     int
+	NSFW      bool
+	Saved     bool
+
+	// ThreadID is the ID of the post a comment belongs to, or of the post
+	// itself.
+	ThreadID string
+
+	// editable is false for link posts, which have no text to overwrite.
+	editable bool
+	// deleted is true once Reddit shows the author as deleted.
+	deleted bool
+}
+
+func commentTarget(comment *reddit.Comment) target {
+	t := target{
+		kind:      kindComment,
+		ID:        comment.ID,
+		FullID:    "t1_" + comment.ID,
+		Subreddit: comment.SubredditName,
+		Title:     comment.PostTitle,
+		Body:      comment.Body,
+		Permalink: comment.Permalink,
+		Edited:    comment.Edited != nil && !comment.Edited.IsZero(),
+		Score:     comment.Score,
+		NSFW:      comment.NSFW,
+		Saved:     comment.Saved,
+		ThreadID:  strings.TrimPrefix(comment.PostID, "t3_"),
+		editable:  true,
+		deleted:   comment.Author == deletedAuthor,
+	}
+	if comment.Created != nil {
+		t.Created = comment.Created.Time
+	}
+
+	return t
+}
+
+func postTarget(post *reddit.Post) target {
+	t := target{
+		kind:      kindPost,
+		ID:        post.ID,
+		FullID:    "t3_" + post.ID,
+		Subreddit: post.SubredditName,
+		Title:     post.Title,
+		Body:      post.Body,
+		Permalink: post.Permalink,
+		Edited:    post.Edited != nil && !post.Edited.IsZero(),
+		Score:     post.Score,
+		NSFW:      post.NSFW,
+		Saved:     post.Saved,
+		ThreadID:  post.ID,
+		editable:  post.IsSelfPost,
+		deleted:   post.Author == deletedAuthor,
+	}
+	if post.Created != nil {
+		t.Created = post.Created.Time
+	}
+
+	return t
+}
+
+// namespace returns the badger namespace holding the target's state.
+func (t target) namespace() string {
+	switch t.kind {
+	case kindPost:
+		return postsNamespace
+	case kindMessage:
+		return messagesNamespace
+	}
+
+	return deleterNamespace
+}
+
+// item extracts the attributes the retention rules match on. Posts match on
+// their title and selftext together, messages on their subject and text.
+func (t target) item() rules.Item {
+	body := t.Body
+	if t.kind == kindPost || t.kind == kindMessage {
+		body = t.Title + "\n" + t.Body
+	}
+
+	return rules.Item{
+		Age:       time.Since(t.Created),
+		Subreddit: t.Subreddit,
+		Score:     t.Score,
+		Body:      body,
+		Edited:    t.Edited,
+		NSFW:      t.NSFW,
+	}
+}
+
+// edit replaces the text of the target.
+func (ds *DeleteService) edit(ctx context.Context, t target, text string) error {
+	if t.kind == kindPost {
+		_, _, err := ds.client.Post.Edit(ctx, t.FullID, text)
+		return err
+	}
+
+	_, _, err := ds.client.Comment.Edit(ctx, t.FullID, text)
+	return err
+}
+
+// remove deletes the target.
+func (ds *DeleteService) remove(ctx context.Context, t target) (*reddit.Response, error) {
+	if t.kind == kindPost {
+		return ds.client.Post.Delete(ctx, t.FullID)
+	}
+
+	return ds.client.Comment.Delete(ctx, t.FullID)
+}
+
+// fetchTarget re-reads the target through the info endpoint. The boolean is
+// false if Reddit no longer returns it.
+func (ds *DeleteService) fetchTarget(ctx context.Context, t target) (target, bool, error) {
+	posts, comments, _, _, err := ds.client.Listings.Get(ctx, t.FullID)
+	if err != nil {
+		return target{}, false, err
+	}
+
+	for _, p := range posts {
+		if p.ID == t.ID {
+			return postTarget(p), true, nil
+		}
+	}
+
+	for _, c := range comments {
+		if c.ID == t.ID {
+			return commentTarget(c), true, nil
+		}
+	}
+
+	return target{}, false, nil
+}
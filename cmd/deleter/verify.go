@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+var errStillVisible = errors.New("still visible after delete")
+
+// gone reports whether Reddit shows both the author and the text of the
+// target as deleted.
+func (t target) gone() bool {
+	return t.deleted && (t.Body == "" || t.Body == deletedBody || t.Body == removedBody)
+}
+
+// newTarget returns a target that only knows its kind and ID, enough to fetch
+// it or to address its state.
+func newTarget(kind, id string) target {
+	prefix := "t1_"
+	if kind == kindPost {
+		prefix = "t3_"
+	}
+
+	return target{kind: kind, ID: id, FullID: prefix + id}
+}
+
+// verifyDeletions re-fetches every target whose delete call succeeded, in
+// batches through the info endpoint. Targets Reddit shows as deleted, or no
+// longer returns, are marked verified; targets still visible go back on the
+// retry queue.
+func (ds *DeleteService) verifyDeletions(ctx context.Context) error {
+	pending, err := requestedDeletions(ds.db)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	log.WithField("pending", len(pending)).Info("Verifying deletions")
+
+	verified, requeued := 0, 0
+	for start := 0; start < len(pending); start += infoBatchSize {
+		if err := ds.tracker.WaitIfPaused(ctx); err != nil {
+			return err
+		}
+
+		batch := pending[start:min(start+infoBatchSize, len(pending))]
+		fullIDs := make([]string, len(batch))
+		for i, t := range batch {
+			fullIDs[i] = t.FullID
+		}
+
+		posts, comments, _, _, err := ds.client.Listings.Get(ctx, fullIDs...)
+		if err != nil {
+			return err
+		}
+
+		visible := make(map[string]target, len(batch))
+		for _, comment := range comments {
+			visible[comment.FullID] = commentTarget(comment)
+		}
+		for _, post := range posts {
+			visible[post.FullID] = postTarget(post)
+		}
+
+		for _, t := range batch {
+			current, found := visible[t.FullID]
+			if err := ds.verifyDeletion(t, current, found); err != nil {
+				log.WithFields(log.Fields{
+					"kind":  t.kind,
+					"id":    t.ID,
+					"error": err,
+				}).Error("Failed to record verification")
+				continue
+			}
+
+			if found && !current.gone() {
+				requeued++
+			} else {
+				verified++
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"verified": verified,
+		"requeued": requeued,
+	}).Info("Verification finished")
+
+	return nil
+}
+
+// verifyDeletion records the result of re-fetching a target.
+func (ds *DeleteService) verifyDeletion(t, current target, found bool) error {
+	record, err := getRecord(ds.db, t)
+	if err != nil {
+		return err
+	}
+
+	if !found || current.gone() {
+		return moveRecord(ds.db, t, &record, stateVerifiedGone, nil)
+	}
+
+	log.WithFields(log.Fields{
+		"kind":      t.kind,
+		"id":        t.ID,
+		"permalink": current.Permalink,
+	}).Warn("Still visible after delete, requeueing")
+
+	if err := moveRecord(ds.db, t, &record, stateFailed, errStillVisible); err != nil {
+		return err
+	}
+
+	return ds.scheduleRetry(current, &record, errStillVisible)
+}
+
+// requestedDeletions lists the targets whose delete call succeeded but which
+// have not been verified yet.
+func requestedDeletions(db badger.DB) ([]target, error) {
+	var pending []target
+	for _, kind := range []string{kindComment, kindPost} {
+		namespace := newTarget(kind, "").namespace()
+		err := db.IteratePrefix([]byte(namespace), nil, func(key, value []byte) error {
+			record, err := decodeRecord(value)
+			if err != nil {
+				return err
+			}
+
+			if record.State == stateDeleteRequested {
+				pending = append(pending, newTarget(kind, string(key)))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return pending, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
@@ -13,7 +14,10 @@ import (
 
 	"github.com/carfloresf/reddit-bot/config"
 	badger "github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/metrics"
 	"github.com/carfloresf/reddit-bot/internal/pushreddit"
+	"github.com/carfloresf/reddit-bot/internal/redditauth"
+	"github.com/carfloresf/reddit-bot/internal/status"
 )
 
 const (
@@ -35,6 +39,12 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// The downloader logs in with the password of the top level reddit
+	// section; accounts and oauth are deleter only.
+	if err := config.ValidatePasswordLogin(cfg.Reddit); err != nil {
+		log.Fatalf("downloader login %s", err)
+	}
+
 	badgerDB, err := badger.NewBadgerDB(cfg.DB.DBFile)
 	if err != nil {
 		log.Fatalf("badgerDB open failed %s", err)
@@ -58,7 +68,11 @@ func main() {
 
 	// add your reddit username and password, secret and client id in here
 	credentials := reddit.Credentials{ID: cfg.Reddit.ClientID, Secret: cfg.Reddit.Secret, Username: cfg.Reddit.Username, Password: cfg.Reddit.Password}
-	client, err := reddit.NewClient(credentials)
+	client, err := reddit.NewClient(credentials,
+		reddit.WithBaseURL(cfg.API.RedditAPIURL),
+		reddit.WithTokenURL(redditauth.TokenURL(cfg.API.RedditOAuthURL)),
+		reddit.WithUserAgent(cfg.API.UserAgent),
+	)
 	if err != nil {
 		log.Fatalf("reddit client failed %s", err)
 	}
@@ -68,7 +82,7 @@ func main() {
 		log.Fatalf("reddit get subreddit failed %s", err)
 	}
 
-	clientPush := pushreddit.NewClient()
+	clientPush := pushreddit.NewClient(cfg.API.PushshiftURL, cfg.API.UserAgent)
 
 	now := time.Now()
 
@@ -79,19 +93,47 @@ func main() {
 
 	log.Printf("keys: %d", len(keysp))
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// The download is a single run lasting as long as the process.
+	tracker := status.NewTracker()
+	tracker.StartRun()
+
+	if err := metrics.RegisterDB(badgerDB); err != nil {
+		log.Fatalf("metrics register failed %s", err)
+	}
+
+	server := status.NewServer(cfg.HTTP.Secret)
+	server.Handle("/metrics", metrics.Handler())
+	server.Register(subreddit, tracker)
+
+	serverDone := make(chan struct{})
+	go func() {
+		defer close(serverDone)
+		if err := server.ListenAndServe(ctx, net.JoinHostPort(cfg.HTTP.Addr, cfg.HTTP.Port)); err != nil {
+			log.Errorf("status API failed %s", err)
+		}
+	}()
+
 	var receiveChan = make(chan []pushreddit.Subreddit, 10000)
 
-	storeService := NewStoreService(badgerDB)
+	storeService := NewStoreService(badgerDB, tracker)
 	storeService.Store(subreddit, receiveChan)
 
 	go func() {
 		for i := index; i < total; i++ {
+			if err := tracker.WaitIfPaused(ctx); err != nil {
+				return
+			}
+
 			posts, err := clientPush.GetPostsSubreddit(subreddit, now.Add(time.Duration(-i)*time.Hour*6), now.Add(time.Duration(-(i-1))*time.Hour*6), 100000000)
 			if err != nil {
 				log.Fatalf("reddit get subreddit posts failed %s", err)
 			}
 
 			receiveChan <- posts.Data
+			tracker.Add("windows_fetched", 1)
 
 			log.Println("index", i)
 			err = badgerDB.Set([]byte(indexPrefix), []byte(indexKey), []byte(cast.ToString(i)))
@@ -101,10 +143,8 @@ func main() {
 		}
 	}()
 
-	c := make(chan os.Signal)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-
-	<-c
+	<-ctx.Done()
+	<-serverDone
 
 	log.Infof("waiting for store service to finish")
 
@@ -4,17 +4,21 @@ import (
 	"bytes"
 	"encoding/json"
 	"github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/metrics"
 	"github.com/carfloresf/reddit-bot/internal/pushreddit"
+	"github.com/carfloresf/reddit-bot/internal/status"
 	log "github.com/sirupsen/logrus"
 )
 
 type StoreService struct {
-	db badger.DB
+	db      badger.DB
+	tracker *status.Tracker
 }
 
-func NewStoreService(db badger.DB) *StoreService {
+func NewStoreService(db badger.DB, tracker *status.Tracker) *StoreService {
 	return &StoreService{
-		db: db,
+		db:      db,
+		tracker: tracker,
 	}
 }
 
@@ -22,6 +26,8 @@ func (ss *StoreService) Store(subreddit string, receiveChan <-chan []pushreddit.
 	go func() {
 		for posts := range receiveChan {
 			log.Printf("received %d posts", len(posts))
+			ss.tracker.Add("posts_received", int64(len(posts)))
+			metrics.PostsFetched.Add(float64(len(posts)))
 
 			for _, post := range posts {
 				postID := postPrefix + post.ID
@@ -38,14 +44,19 @@ func (ss *StoreService) Store(subreddit string, receiveChan <-chan []pushreddit.
 					err := json.NewEncoder(reqBodyBytes).Encode(post)
 					if err != nil {
 						log.Errorf("json encode failed %s", err)
+						ss.tracker.Error(err)
 						return
 					}
 
 					err = ss.db.Set([]byte(subreddit), []byte(post.ID), reqBodyBytes.Bytes())
 					if err != nil {
 						log.Errorf("badgerDB set failed %s", err)
+						ss.tracker.Error(err)
 						return
 					}
+
+					ss.tracker.Add("posts_stored", 1)
+					metrics.PostsStored.Inc()
 				}
 
 			}
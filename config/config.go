@@ -2,31 +2,170 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type (
 	Config struct {
-		HTTP   `yaml:"http"`
-		DB     `yaml:"db"`
-		Reddit `yaml:"reddit"`
+		HTTP    `yaml:"http"`
+		DB      `yaml:"db"`
+		API     `yaml:"api"`
+		Reddit  `yaml:"reddit"`
+		Deleter `yaml:"deleter"`
+
+		// Accounts lists the Reddit accounts the deleter handles. When empty,
+		// the top level reddit and deleter sections form the only account.
+		Accounts []Account `yaml:"accounts"`
 	}
 
+	// HTTP is the address the status API and review UI are served on. The
+	// control endpoints and the review UI are only served when Secret is
+	// set, and ask for it as the password of HTTP basic authentication.
 	HTTP struct {
-		Addr string `env-required:"true" yaml:"address" env:"HTTP_ADDR"`
-		Port string `env-required:"true" yaml:"port" env:"HTTP_PORT"`
+		Addr   string `env-required:"true" yaml:"address" env:"HTTP_ADDR"`
+		Port   string `env-required:"true" yaml:"port" env:"HTTP_PORT"`
+		Secret string `yaml:"secret" env:"HTTP_SECRET"`
 	}
 
 	DB struct {
 		DBFile string `env-required:"true" yaml:"db_file" env:"DB_FILE"`
 	}
 
+	// API holds the hosts both commands talk to and the User-Agent they send.
+	// RedditAPIURL serves the API calls made with an access token;
+	// RedditOAuthURL serves the authorize and access token endpoints and the
+	// pages links to comments and posts point at. An empty
+	// UserAgent keeps the Reddit client's default and Go's for Pushshift.
+	API struct {
+		PushshiftURL   string `yaml:"pushshift_url" env:"API_PUSHSHIFT_URL" env-default:"https://api.pushshift.io"`
+		RedditAPIURL   string `yaml:"reddit_api_url" env:"API_REDDIT_API_URL" env-default:"https://oauth.reddit.com"`
+		RedditOAuthURL string `yaml:"reddit_oauth_url" env:"API_REDDIT_OAUTH_URL" env-default:"https://www.reddit.com"`
+		UserAgent      string `yaml:"user_agent" env:"API_USER_AGENT"`
+	}
+
+	// Reddit holds the credentials of an account. They are only required at
+	// the top level when no accounts are listed. Auth is "password" to log in
+	// with Password, or "oauth" to use a refresh token obtained once with the
+	// authorize command and stored in badger encrypted with TokenKey.
 	Reddit struct {
-		Username string `env-required:"true" yaml:"username" env:"REDDIT_USERNAME"`
-		Password string `env-required:"true" yaml:"password" env:"REDDIT_PASSWORD"`
-		ClientID string `env-required:"true" yaml:"client_id" env:"REDDIT_CLIENT_ID"`
-		Secret   string `env-required:"true" yaml:"secret" env:"REDDIT_SECRET"`
+		Username string `yaml:"username" env:"REDDIT_USERNAME"`
+		Password string `yaml:"password" env:"REDDIT_PASSWORD"`
+		ClientID string `yaml:"client_id" env:"REDDIT_CLIENT_ID"`
+		Secret   string `yaml:"secret" env:"REDDIT_SECRET"`
+		Auth     string `yaml:"auth" env:"REDDIT_AUTH"`
+		TokenKey string `yaml:"token_key" env:"REDDIT_TOKEN_KEY"`
+
+		// RateBudget caps the requests per minute sent for the account, on
+		// top of the limit Reddit reports. Zero means no extra cap.
+		RateBudget int `yaml:"rate_budget" env:"REDDIT_RATE_BUDGET" env-default:"0"`
+	}
+
+	// Account is one Reddit account with its own credentials and deleter
+	// settings. Its data is kept apart from other accounts under Name.
+	Account struct {
+		Name    string `yaml:"name"`
+		Reddit  `yaml:"reddit"`
+		Deleter `yaml:"deleter"`
+	}
+
+	Deleter struct {
+		Overwrite `yaml:"overwrite"`
+
+		// DryRun runs the full selection without calling any mutating endpoint.
+		DryRun bool `yaml:"dry_run" env:"DELETER_DRY_RUN" env-default:"false"`
+
+		// KeepSaved protects comments and posts the user has saved.
+		KeepSaved bool `yaml:"keep_saved" env:"DELETER_KEEP_SAVED" env-default:"false"`
+
+		// RequireApproval holds selected items until a reviewer approves
+		// them, in the web UI served on the HTTP address while the deleter
+		// runs with an HTTP secret, or with the approve command. Approved
+		// items are deleted at the start of the next run.
+		RequireApproval bool `yaml:"require_approval" env:"DELETER_REQUIRE_APPROVAL" env-default:"false"`
+
+		// Workers is the number of items deleted concurrently. Order is
+		// "listing" to delete in the order the listings return items, or
+		// "oldest_first" to collect the whole pass and start with the oldest.
+		Workers int    `yaml:"workers" env:"DELETER_WORKERS" env-default:"1"`
+		Order   string `yaml:"order" env:"DELETER_ORDER" env-default:"listing"`
+
+		Schedule `yaml:"schedule"`
+		Retry    `yaml:"retry"`
+
+		// Cleanup lists the listings to clear after each pass: "saved" to
+		// unsave items, "upvoted" and "downvoted" to remove votes. The same
+		// rules decide which items are cleared.
+		Cleanup []string `yaml:"cleanup" env:"DELETER_CLEANUP"`
+
+		Inbox Inbox `yaml:"inbox"`
+
+		// RulesFile points to a YAML file holding the retention rules. When
+		// set, its rules replace any listed inline under Rules.
+		RulesFile string `yaml:"rules_file" env:"DELETER_RULES_FILE"`
+		Rules     []Rule `yaml:"rules"`
+	}
+
+	// Overwrite controls editing a comment to replacement text before it is
+	// deleted. Mode is one of "random", "fixed" or "template"; Text holds the
+	// fixed string or the text/template source.
+	Overwrite struct {
+		Enabled bool          `yaml:"enabled" env:"DELETER_OVERWRITE" env-default:"false"`
+		Mode    string        `yaml:"mode" env:"DELETER_OVERWRITE_MODE" env-default:"random"`
+		Text    string        `yaml:"text" env:"DELETER_OVERWRITE_TEXT"`
+		Words   int           `yaml:"words" env:"DELETER_OVERWRITE_WORDS" env-default:"12"`
+		Wait    time.Duration `yaml:"wait" env:"DELETER_OVERWRITE_WAIT" env-default:"5s"`
+	}
+
+	// Inbox controls deleting private messages, received and sent. Its rules
+	// match on the age of a message and on its subject and text; messages no
+	// rule selects are kept. When Enabled, the inbox is cleared after each
+	// pass.
+	Inbox struct {
+		Enabled bool   `yaml:"enabled" env:"DELETER_INBOX" env-default:"false"`
+		Rules   []Rule `yaml:"rules"`
+	}
+
+	// Schedule controls daemon mode. Passes repeat every Interval, or at the
+	// times of the standard five field Cron expression when it is set, each
+	// delayed by a random duration of up to Jitter.
+	Schedule struct {
+		Daemon   bool          `yaml:"daemon" env:"DELETER_DAEMON" env-default:"false"`
+		Interval time.Duration `yaml:"interval" env:"DELETER_INTERVAL" env-default:"6h"`
+		Cron     string        `yaml:"cron" env:"DELETER_CRON"`
+		Jitter   time.Duration `yaml:"jitter" env:"DELETER_JITTER" env-default:"5m"`
+	}
+
+	// Retry controls the retry queue of failed deletions. The wait before
+	// attempt n is Backoff doubled n-1 times, capped at MaxBackoff. Items
+	// still failing after MaxAttempts attempts, or failing with an error that
+	// cannot go away, are moved to the dead-letter list.
+	Retry struct {
+		MaxAttempts int           `yaml:"max_attempts" env:"DELETER_RETRY_MAX_ATTEMPTS" env-default:"5"`
+		Backoff     time.Duration `yaml:"backoff" env:"DELETER_RETRY_BACKOFF" env-default:"10m"`
+		MaxBackoff  time.Duration `yaml:"max_backoff" env:"DELETER_RETRY_MAX_BACKOFF" env-default:"24h"`
+	}
+
+	// RuleSet is the content of a rules file.
+	RuleSet struct {
+		Rules []Rule `yaml:"rules"`
+	}
+
+	// Rule is a single keep or delete rule. Every condition that is set must
+	// match for the rule to apply; unset conditions match anything.
+	Rule struct {
+		Name       string        `yaml:"name"`
+		Action     string        `yaml:"action"`
+		OlderThan  time.Duration `yaml:"older_than"`
+		NewerThan  time.Duration `yaml:"newer_than"`
+		Subreddits []string      `yaml:"subreddits"`
+		MinScore   *int          `yaml:"min_score"`
+		MaxScore   *int          `yaml:"max_score"`
+		Keywords   []string      `yaml:"keywords"`
+		Regex      string        `yaml:"regex"`
+		Edited     *bool         `yaml:"edited"`
+		NSFW       *bool         `yaml:"nsfw"`
 	}
 )
 
@@ -43,5 +182,115 @@ func ReadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := readDeleterRules(&cfg.Deleter); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Accounts) == 0 {
+		if err := validateReddit(cfg.Reddit); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool, len(cfg.Accounts))
+	for i := range cfg.Accounts {
+		account := &cfg.Accounts[i]
+
+		if account.Name == "" || seen[account.Name] {
+			return nil, fmt.Errorf("config error: account %d needs a unique name", i+1)
+		}
+		seen[account.Name] = true
+
+		if err := validateReddit(account.Reddit); err != nil {
+			return nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+
+		// Apply the defaults to settings the account leaves out. DELETER_*
+		// environment variables apply to every account.
+		if err := cleanenv.ReadEnv(&account.Deleter); err != nil {
+			return nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+
+		if err := readDeleterRules(&account.Deleter); err != nil {
+			return nil, fmt.Errorf("account %s: %w", account.Name, err)
+		}
+	}
+
 	return cfg, nil
 }
+
+// AccountList returns the configured accounts, or a single unnamed account
+// built from the top level reddit and deleter sections.
+func (c *Config) AccountList() []Account {
+	if len(c.Accounts) > 0 {
+		return c.Accounts
+	}
+
+	return []Account{{Reddit: c.Reddit, Deleter: c.Deleter}}
+}
+
+func readDeleterRules(deleter *Deleter) error {
+	if deleter.RulesFile == "" {
+		return nil
+	}
+
+	ruleSet, err := ReadRules(deleter.RulesFile)
+	if err != nil {
+		return err
+	}
+
+	deleter.Rules = ruleSet.Rules
+
+	return nil
+}
+
+const (
+	AuthPassword = "password"
+	AuthOAuth    = "oauth"
+)
+
+func validateReddit(r Reddit) error {
+	if r.Username == "" || r.ClientID == "" || r.Secret == "" {
+		return fmt.Errorf("config error: reddit username, client_id and secret are required")
+	}
+
+	switch r.Auth {
+	case "", AuthPassword:
+		if r.Password == "" {
+			return fmt.Errorf("config error: reddit password is required for password auth")
+		}
+	case AuthOAuth:
+		if r.TokenKey == "" {
+			return fmt.Errorf("config error: reddit token_key is required for oauth auth")
+		}
+	default:
+		return fmt.Errorf("config error: unknown reddit auth %q", r.Auth)
+	}
+
+	return nil
+}
+
+// ValidatePasswordLogin checks that r holds everything a password login
+// needs. The downloader only logs in with a password.
+func ValidatePasswordLogin(r Reddit) error {
+	if r.Auth != "" && r.Auth != AuthPassword {
+		return fmt.Errorf("config error: reddit auth %q is not supported, password auth is required", r.Auth)
+	}
+
+	if r.Username == "" || r.Password == "" || r.ClientID == "" || r.Secret == "" {
+		return fmt.Errorf("config error: reddit username, password, client_id and secret are required")
+	}
+
+	return nil
+}
+
+func ReadRules(path string) (*RuleSet, error) {
+	ruleSet := &RuleSet{}
+
+	err := cleanenv.ReadConfig(path, ruleSet)
+	if err != nil {
+		return nil, fmt.Errorf("rules error: %w", err)
+	}
+
+	return ruleSet, nil
+}
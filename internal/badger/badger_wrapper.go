@@ -21,6 +21,10 @@ const (
 	badgerGCInterval = 10 * time.Minute
 )
 
+// ErrKeyNotFound is returned by Get when a key does not exist in the given
+// namespace.
+var ErrKeyNotFound = badger.ErrKeyNotFound
+
 type (
 	// DB defines an embedded key/value store database interface.
 	DB interface {
@@ -31,6 +35,8 @@ type (
 		Iterate() error
 		IterateKeys() ([]string, error)
 		SearchPrefix(prefix []byte) (keys []string, err error)
+		IteratePrefix(namespace, prefix []byte, fn func(key, value []byte) error) error
+		Size() (lsm, vlog int64)
 		Close() error
 	}
 
@@ -122,6 +128,12 @@ func (bdb *BadgerDB) Has(namespace, key []byte) (ok bool, err error) {
 	return
 }
 
+// Size implements the DB interface. It returns the sizes in bytes of the LSM
+// tree and of the value log, as last computed by badger.
+func (bdb *BadgerDB) Size() (lsm, vlog int64) {
+	return bdb.DB.Size()
+}
+
 // Close implements the DB interface. It closes the connection to the underlying
 // BadgerDB database as well as invoking the context's cancel function.
 func (bdb *BadgerDB) Close() error {
@@ -234,3 +246,30 @@ func (bdb *BadgerDB) SearchPrefix(prefix []byte) (keys []string, err error) {
 
 	return keys, err
 }
+
+// IteratePrefix implements the DB interface. It calls fn for every key in the
+// namespace starting with prefix, in key order, without loading all keys
+// first. The key passed to fn has the namespace stripped; key and value are
+// only valid during the call. Iteration stops at the first error fn returns.
+func (bdb *BadgerDB) IteratePrefix(namespace, prefix []byte, fn func(key, value []byte) error) error {
+	nsPrefix := badgerNamespaceKey(namespace, nil)
+	fullPrefix := badgerNamespaceKey(namespace, prefix)
+
+	return bdb.DB.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = fullPrefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(fullPrefix); it.ValidForPrefix(fullPrefix); it.Next() {
+			item := it.Item()
+			key := item.Key()[len(nsPrefix):]
+			err := item.Value(func(v []byte) error {
+				return fn(key, v)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,76 @@
+package badger
+
+// PrefixedDB is a view of a DB that keeps its keys apart from every other
+// view by prefixing all namespaces. It lets several users of one database,
+// such as the accounts of a deployment, reuse the same namespace names.
+type PrefixedDB struct {
+	db     DB
+	prefix string
+}
+
+// NewPrefixedDB returns a DB whose namespaces are all stored under prefix.
+// Closing it does not close the underlying database.
+func NewPrefixedDB(db DB, prefix string) DB {
+	return &PrefixedDB{
+		db:     db,
+		prefix: prefix + ":",
+	}
+}
+
+func (p *PrefixedDB) namespace(namespace []byte) []byte {
+	return append([]byte(p.prefix), namespace...)
+}
+
+// Get implements the DB interface.
+func (p *PrefixedDB) Get(namespace, key []byte) ([]byte, error) {
+	return p.db.Get(p.namespace(namespace), key)
+}
+
+// Set implements the DB interface.
+func (p *PrefixedDB) Set(namespace, key, value []byte) error {
+	return p.db.Set(p.namespace(namespace), key, value)
+}
+
+// Has implements the DB interface.
+func (p *PrefixedDB) Has(namespace, key []byte) (bool, error) {
+	return p.db.Has(p.namespace(namespace), key)
+}
+
+// Delete implements the DB interface.
+func (p *PrefixedDB) Delete(namespace, key []byte) error {
+	return p.db.Delete(p.namespace(namespace), key)
+}
+
+// Iterate implements the DB interface. It iterates the whole underlying
+// database.
+func (p *PrefixedDB) Iterate() error {
+	return p.db.Iterate()
+}
+
+// IterateKeys implements the DB interface. It only returns the keys of this
+// view, with their full underlying names.
+func (p *PrefixedDB) IterateKeys() ([]string, error) {
+	return p.db.SearchPrefix([]byte(p.prefix))
+}
+
+// SearchPrefix implements the DB interface. The prefix is matched against the
+// raw keys of this view.
+func (p *PrefixedDB) SearchPrefix(prefix []byte) ([]string, error) {
+	return p.db.SearchPrefix(p.namespace(prefix))
+}
+
+// IteratePrefix implements the DB interface.
+func (p *PrefixedDB) IteratePrefix(namespace, prefix []byte, fn func(key, value []byte) error) error {
+	return p.db.IteratePrefix(p.namespace(namespace), prefix, fn)
+}
+
+// Size implements the DB interface. It reports the whole underlying database.
+func (p *PrefixedDB) Size() (lsm, vlog int64) {
+	return p.db.Size()
+}
+
+// Close implements the DB interface. It is a no-op; the owner of the
+// underlying database closes it.
+func (p *PrefixedDB) Close() error {
+	return nil
+}
@@ -0,0 +1,544 @@
+// Package fakereddit is an in-memory stand-in for the parts of the Reddit API
+// the deleter uses, served with net/http/httptest. Point a reddit.Client at
+// URL, for both the API and the OAuth token endpoint, to exercise the deleter
+// end to end without touching real accounts.
+package fakereddit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// token is the access token handed out by the token endpoint and
+	// required on every API request.
+	token = "fake-access-token"
+
+	deletedText = "[deleted]"
+
+	defaultLimit = 25
+	maxLimit     = 100
+)
+
+type (
+	// Server is a fake Reddit API for a single user. It serves the OAuth
+	// token, user comments and submissions listings, edit and delete, and
+	// info endpoints. Every response carries rate-limit headers. It is
+	// safe for concurrent use.
+	Server struct {
+		*httptest.Server
+
+		username string
+
+		mu       sync.Mutex
+		comments []*Comment
+		posts    []*Post
+		failures map[string][]failure
+		requests map[string]int
+
+		// The rate-limit window: limit requests per window, starting at
+		// windowStart.
+		limit       int
+		window      time.Duration
+		windowStart time.Time
+		used        int
+	}
+
+	// Comment is a comment of the user held by the Server.
+	Comment struct {
+		ID        string
+		Subreddit string
+		PostID    string
+		PostTitle string
+		Body      string
+		Score     int
+		Created   time.Time
+
+		// Edited and Deleted are set by the edit and delete endpoints.
+		Edited  bool
+		Deleted bool
+	}
+
+	// Post is a submission of the user held by the Server. Posts with a URL
+	// are link posts, which cannot be edited; the others are self posts.
+	Post struct {
+		ID        string
+		Subreddit string
+		Title     string
+		Body      string
+		URL       string
+		Score     int
+		NSFW      bool
+		Created   time.Time
+
+		// Edited and Deleted are set by the edit and delete endpoints.
+		Edited  bool
+		Deleted bool
+	}
+
+	// entry is a comment or post in a listing.
+	entry struct {
+		fullname string
+		deleted  bool
+		thing    func() map[string]any
+	}
+
+	// failure is an injected error answered instead of a request.
+	failure struct {
+		status int
+		label  string
+	}
+)
+
+// New starts a Server for username. Rate-limit windows last a second and
+// allow 600 requests, so clients that pace themselves on the headers are not
+// slowed down. Close the Server when done.
+func New(username string) *Server {
+	s := &Server{
+		username:    username,
+		failures:    make(map[string][]failure),
+		requests:    make(map[string]int),
+		limit:       600,
+		window:      time.Second,
+		windowStart: time.Now(),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// AddComment adds a comment of the user. Listings return comments in the
+// order they were added. Missing post IDs and creation times are filled in.
+func (s *Server) AddComment(c Comment) {
+	if c.PostID == "" {
+		c.PostID = "post_" + c.ID
+	}
+
+	if c.Created.IsZero() {
+		c.Created = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.comments = append(s.comments, &c)
+}
+
+// Comment returns the comment with the given ID as the Server holds it. The
+// body of a deleted comment is the text it had when it was deleted.
+func (s *Server) Comment(id string) (Comment, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.comment(id)
+	if c == nil {
+		return Comment{}, false
+	}
+
+	return *c, true
+}
+
+// AddPost adds a submission of the user. Listings return posts in the order
+// they were added. A missing creation time is filled in.
+func (s *Server) AddPost(p Post) {
+	if p.Created.IsZero() {
+		p.Created = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.posts = append(s.posts, &p)
+}
+
+// Post returns the post with the given ID as the Server holds it. The body
+// of a deleted post is the text it had when it was deleted.
+func (s *Server) Post(id string) (Post, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.post(id)
+	if p == nil {
+		return Post{}, false
+	}
+
+	return *p, true
+}
+
+// Fail makes the next n requests to path fail with the given HTTP status.
+func (s *Server) Fail(path string, status, n int) {
+	s.inject(path, failure{status: status}, n)
+}
+
+// Reject makes the next n requests to path fail with a Reddit API error
+// carrying label, such as THREAD_LOCKED, answered with a 200 status the way
+// Reddit does.
+func (s *Server) Reject(path, label string, n int) {
+	s.inject(path, failure{status: http.StatusOK, label: label}, n)
+}
+
+// SetRateLimit starts a new rate-limit window allowing limit requests over
+// window. Once a window is used up the headers report nothing remaining until
+// it resets.
+func (s *Server) SetRateLimit(limit int, window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.limit = limit
+	s.window = window
+	s.windowStart = time.Now()
+	s.used = 0
+}
+
+// Requests returns the number of requests made to path so far.
+func (s *Server) Requests(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests[path]
+}
+
+func (s *Server) inject(path string, f failure, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures[path] = append(s.failures[path], f)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests[r.URL.Path]++
+	s.rateHeaders(w.Header())
+
+	if r.URL.Path == "/api/v1/access_token" {
+		s.token(w, r)
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+token {
+		writeError(w, http.StatusUnauthorized)
+		return
+	}
+
+	if pending := s.failures[r.URL.Path]; len(pending) > 0 {
+		s.failures[r.URL.Path] = pending[1:]
+		writeFailure(w, pending[0])
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/user/" + s.username + "/comments":
+		entries := make([]entry, len(s.comments))
+		for i, c := range s.comments {
+			c := c
+			entries[i] = entry{fullname: "t1_" + c.ID, deleted: c.Deleted, thing: func() map[string]any { return s.commentThing(c) }}
+		}
+		serveListing(w, r, entries)
+	case "/user/" + s.username + "/submitted":
+		entries := make([]entry, len(s.posts))
+		for i, p := range s.posts {
+			p := p
+			entries[i] = entry{fullname: "t3_" + p.ID, deleted: p.Deleted, thing: func() map[string]any { return s.postThing(p) }}
+		}
+		serveListing(w, r, entries)
+	case "/api/info":
+		s.info(w, r)
+	case "/api/editusertext":
+		s.edit(w, r)
+	case "/api/del":
+		s.delete(w, r)
+	default:
+		writeError(w, http.StatusNotFound)
+	}
+}
+
+// rateHeaders counts the request against the current window and sets the
+// headers Reddit sends with every response.
+func (s *Server) rateHeaders(h http.Header) {
+	elapsed := time.Since(s.windowStart)
+	if elapsed >= s.window {
+		s.windowStart = time.Now()
+		s.used = 0
+		elapsed = 0
+	}
+
+	s.used++
+	remaining := max(s.limit-s.used, 0)
+	reset := int(math.Ceil((s.window - elapsed).Seconds()))
+
+	h.Set("X-Ratelimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-Ratelimit-Used", strconv.Itoa(s.used))
+	h.Set("X-Ratelimit-Reset", strconv.Itoa(reset))
+}
+
+// token answers any grant with the fixed access token.
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+		"scope":        "*",
+	})
+}
+
+// serveListing serves the entries that are not deleted, a page of at most
+// limit after the given fullname. Like Reddit, a fullname that is unknown or
+// deleted since gives an empty page.
+func serveListing(w http.ResponseWriter, r *http.Request, entries []entry) {
+	limit := defaultLimit
+	if value, err := strconv.Atoi(r.Form.Get("limit")); err == nil && value > 0 {
+		limit = min(value, maxLimit)
+	}
+
+	var visible []entry
+	for _, e := range entries {
+		if !e.deleted {
+			visible = append(visible, e)
+		}
+	}
+
+	if after := r.Form.Get("after"); after != "" {
+		start := len(visible)
+		for i, e := range visible {
+			if e.fullname == after {
+				start = i + 1
+				break
+			}
+		}
+		visible = visible[start:]
+	}
+
+	page := visible[:min(limit, len(visible))]
+
+	next := ""
+	if len(page) < len(visible) {
+		next = page[len(page)-1].fullname
+	}
+
+	children := make([]any, len(page))
+	for i, e := range page {
+		children[i] = e.thing()
+	}
+
+	writeJSON(w, listing(children, next))
+}
+
+// info serves the comments and posts with the given fullnames. Deleted ones
+// are returned the way Reddit shows them.
+func (s *Server) info(w http.ResponseWriter, r *http.Request) {
+	var children []any
+	for _, id := range strings.Split(r.Form.Get("id"), ",") {
+		kind, id, _ := strings.Cut(id, "_")
+		switch kind {
+		case "t1":
+			if c := s.comment(id); c != nil {
+				children = append(children, s.commentThing(c))
+			}
+		case "t3":
+			if p := s.post(id); p != nil {
+				children = append(children, s.postThing(p))
+			}
+		}
+	}
+
+	writeJSON(w, listing(children, ""))
+}
+
+// edit replaces the text of a comment or self post.
+func (s *Server) edit(w http.ResponseWriter, r *http.Request) {
+	id := r.Form.Get("thing_id")
+	text := r.Form.Get("text")
+
+	if strings.HasPrefix(id, "t3_") {
+		p := s.post(strings.TrimPrefix(id, "t3_"))
+		if p == nil || p.Deleted || p.URL != "" {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+
+		p.Body = text
+		p.Edited = true
+
+		writeJSON(w, s.postThing(p)["data"])
+		return
+	}
+
+	c := s.comment(strings.TrimPrefix(id, "t1_"))
+	if c == nil || c.Deleted {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+
+	c.Body = text
+	c.Edited = true
+
+	writeJSON(w, s.commentThing(c)["data"])
+}
+
+// delete marks the comment or post deleted. Like Reddit, it succeeds for
+// unknown and already deleted things.
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	id := r.Form.Get("id")
+	if strings.HasPrefix(id, "t3_") {
+		if p := s.post(strings.TrimPrefix(id, "t3_")); p != nil {
+			p.Deleted = true
+		}
+	} else if c := s.comment(strings.TrimPrefix(id, "t1_")); c != nil {
+		c.Deleted = true
+	}
+
+	writeJSON(w, map[string]any{})
+}
+
+func (s *Server) comment(id string) *Comment {
+	for _, c := range s.comments {
+		if c.ID == id {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) post(id string) *Post {
+	for _, p := range s.posts {
+		if p.ID == id {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// commentThing renders a comment as a t1 thing.
+func (s *Server) commentThing(c *Comment) map[string]any {
+	author, body := s.username, c.Body
+	if c.Deleted {
+		author, body = deletedText, deletedText
+	}
+
+	edited := any(false)
+	if c.Edited {
+		edited = float64(time.Now().Unix())
+	}
+
+	return map[string]any{
+		"kind": "t1",
+		"data": map[string]any{
+			"id":          c.ID,
+			"name":        "t1_" + c.ID,
+			"author":      author,
+			"body":        body,
+			"subreddit":   c.Subreddit,
+			"link_id":     "t3_" + c.PostID,
+			"link_title":  c.PostTitle,
+			"permalink":   fmt.Sprintf("/r/%s/comments/%s/_/%s/", c.Subreddit, c.PostID, c.ID),
+			"score":       c.Score,
+			"created_utc": float64(c.Created.Unix()),
+			"edited":      edited,
+		},
+	}
+}
+
+// postThing renders a post as a t3 thing.
+func (s *Server) postThing(p *Post) map[string]any {
+	author, body := s.username, p.Body
+	if p.Deleted {
+		author = deletedText
+		if p.URL == "" {
+			body = deletedText
+		}
+	}
+
+	edited := any(false)
+	if p.Edited {
+		edited = float64(time.Now().Unix())
+	}
+
+	permalink := fmt.Sprintf("/r/%s/comments/%s/_/", p.Subreddit, p.ID)
+	url := p.URL
+	if url == "" {
+		url = s.URL + permalink
+	}
+
+	return map[string]any{
+		"kind": "t3",
+		"data": map[string]any{
+			"id":          p.ID,
+			"name":        "t3_" + p.ID,
+			"author":      author,
+			"title":       p.Title,
+			"selftext":    body,
+			"url":         url,
+			"is_self":     p.URL == "",
+			"subreddit":   p.Subreddit,
+			"permalink":   permalink,
+			"score":       p.Score,
+			"over_18":     p.NSFW,
+			"created_utc": float64(p.Created.Unix()),
+			"edited":      edited,
+		},
+	}
+}
+
+func listing(children []any, after string) map[string]any {
+	if children == nil {
+		children = []any{}
+	}
+
+	return map[string]any{
+		"kind": "Listing",
+		"data": map[string]any{
+			"children": children,
+			"after":    after,
+		},
+	}
+}
+
+func writeFailure(w http.ResponseWriter, f failure) {
+	if f.label == "" {
+		writeError(w, f.status)
+		return
+	}
+
+	writeJSON(w, map[string]any{
+		"json": map[string]any{
+			"errors": [][]string{{f.label, strings.ToLower(f.label), ""}},
+		},
+	})
+}
+
+func writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": http.StatusText(status),
+		"error":   status,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
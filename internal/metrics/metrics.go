@@ -0,0 +1,129 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+	"github.com/carfloresf/reddit-bot/internal/pacer"
+)
+
+const namespace = "redditbot"
+
+var (
+	// PostsFetched counts the posts received from Pushshift by the downloader.
+	PostsFetched = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_fetched_total",
+		Help:      "Posts received from Pushshift.",
+	})
+
+	// PostsStored counts the posts the downloader stored for the first time.
+	PostsStored = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_stored_total",
+		Help:      "Posts stored in badger that were not stored before.",
+	})
+
+	// PushshiftDuration observes Pushshift searches, retries included, by
+	// HTTP status code, or "error" when no response arrived.
+	PushshiftDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "pushshift_request_duration_seconds",
+		Help:      "Duration of Pushshift searches including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"result"})
+
+	// PushshiftRetries counts the Pushshift requests that were retried.
+	PushshiftRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pushshift_retries_total",
+		Help:      "Pushshift requests sent again after a failure.",
+	})
+
+	// Deletions counts the selected comments and posts by outcome.
+	Deletions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "deletions_total",
+		Help:      "Selected comments and posts by outcome.",
+	}, []string{"account", "outcome"})
+)
+
+// Handler returns the handler serving the metrics.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// RegisterRate exposes the rate-limit headroom Reddit last reported to the
+// pacer of an account.
+func RegisterRate(account string, p *pacer.Pacer) error {
+	labels := prometheus.Labels{"account": account}
+
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "ratelimit_remaining",
+			Help:        "Requests left in the current Reddit rate-limit window.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Rate().Remaining) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "ratelimit_used",
+			Help:        "Requests used in the current Reddit rate-limit window.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(p.Rate().Used) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "ratelimit_reset_timestamp_seconds",
+			Help:        "Time the current Reddit rate-limit window resets.",
+			ConstLabels: labels,
+		}, func() float64 {
+			reset := p.Rate().Reset
+			if reset.IsZero() {
+				return 0
+			}
+			return float64(reset.Unix())
+		}),
+	}
+
+	for _, c := range collectors {
+		if err := prometheus.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RegisterDB exposes the LSM tree and value log sizes of the database.
+func RegisterDB(db badger.DB) error {
+	collectors := []prometheus.Collector{
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "badger_lsm_size_bytes",
+			Help:      "Size of the badger LSM tree.",
+		}, func() float64 {
+			lsm, _ := db.Size()
+			return float64(lsm)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "badger_vlog_size_bytes",
+			Help:      "Size of the badger value log.",
+		}, func() float64 {
+			_, vlog := db.Size()
+			return float64(vlog)
+		}),
+	}
+
+	for _, c := range collectors {
+		if err := prometheus.Register(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package pacer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	headerRemaining  = "X-Ratelimit-Remaining"
+	headerUsed       = "X-Ratelimit-Used"
+	headerReset      = "X-Ratelimit-Reset"
+	headerRetryAfter = "Retry-After"
+
+	// Default number of times a request answered with 429 is retried.
+	defaultMaxRetries = 5
+
+	// Backoff bounds used for 429 responses without a Retry-After header.
+	minBackoff = 2 * time.Second
+	maxBackoff = 2 * time.Minute
+)
+
+// Pacer is an http.RoundTripper that spreads requests evenly over Reddit's
+// rate-limit window. After every response it reads the remaining, used and
+// reset headers and spaces the following requests so the quota lasts until
+// the window resets. It never spends the last request of a window, because
+// the Reddit client refuses to send anything once remaining reaches zero.
+// A single Pacer can be shared by any number of goroutines.
+type Pacer struct {
+	base       http.RoundTripper
+	maxRetries int
+	// minInterval enforces an own request budget below Reddit's limit.
+	minInterval time.Duration
+
+	mu sync.Mutex
+	// next is the earliest time the next request may start.
+	next time.Time
+	// interval is the spacing between requests for the current window.
+	interval time.Duration
+	// remaining, used and reset are the last values reported by Reddit.
+	remaining int
+	used      int
+	reset     time.Time
+}
+
+// Rate is a snapshot of the last rate-limit values reported by Reddit.
+type Rate struct {
+	Remaining int
+	Used      int
+	Reset     time.Time
+}
+
+// New returns a Pacer sending requests through base, or through
+// http.DefaultTransport if base is nil. A positive perMinute caps the request
+// rate below what Reddit allows.
+func New(base http.RoundTripper, perMinute int) *Pacer {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	p := &Pacer{
+		base:       base,
+		maxRetries: defaultMaxRetries,
+	}
+
+	if perMinute > 0 {
+		p.minInterval = time.Minute / time.Duration(perMinute)
+	}
+
+	return p
+}
+
+// RoundTrip implements http.RoundTripper. It waits for the request's slot,
+// sends it, and retries with backoff when Reddit answers 429.
+func (p *Pacer) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := p.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		resp, err := p.base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Update(resp.Header)
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= p.maxRetries {
+			return resp, nil
+		}
+
+		// Only requests whose body can be replayed are retried.
+		if req.Body != nil && req.GetBody == nil {
+			return resp, nil
+		}
+
+		backoff := retryAfter(resp.Header, attempt)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		log.WithFields(log.Fields{
+			"url":     req.URL.String(),
+			"attempt": attempt + 1,
+			"backoff": backoff,
+		}).Warn("Rate limited by Reddit, backing off")
+
+		p.delay(backoff)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// Wait blocks until the caller may send its next request, or ctx is done.
+// Each call reserves its own slot, so concurrent callers are spread out too.
+func (p *Pacer) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	slot := p.next
+	if slot.Before(now) {
+		slot = now
+	}
+	p.next = slot.Add(max(p.interval, p.minInterval))
+	p.mu.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return nil
+	}
+
+	log.WithField("wait", wait).Debug("Pacing request")
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Update recomputes the pacing from the rate-limit headers of a response.
+// Responses without those headers are ignored.
+func (p *Pacer) Update(h http.Header) {
+	remainingHeader := h.Get(headerRemaining)
+	resetHeader := h.Get(headerReset)
+	if remainingHeader == "" || resetHeader == "" {
+		return
+	}
+
+	remainingFloat, err := strconv.ParseFloat(remainingHeader, 64)
+	if err != nil {
+		return
+	}
+	resetSeconds, err := strconv.Atoi(resetHeader)
+	if err != nil {
+		return
+	}
+	used, _ := strconv.Atoi(h.Get(headerUsed))
+
+	remaining := int(remainingFloat)
+	now := time.Now()
+	reset := now.Add(time.Duration(resetSeconds) * time.Second)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.remaining = remaining
+	p.used = used
+	p.reset = reset
+
+	// Keep one request in reserve; the window is exhausted once it is all
+	// that is left.
+	budget := remaining - 1
+	if budget <= 0 {
+		p.interval = 0
+		if p.next.Before(reset) {
+			p.next = reset
+		}
+
+		log.WithField("reset", reset.Format(time.RFC3339)).Info("Rate limit exhausted, pausing until reset")
+		return
+	}
+
+	p.interval = time.Until(reset) / time.Duration(budget)
+}
+
+// Rate returns the last rate-limit values reported by Reddit.
+func (p *Pacer) Rate() Rate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return Rate{
+		Remaining: p.remaining,
+		Used:      p.used,
+		Reset:     p.reset,
+	}
+}
+
+// delay pushes the next slot at least d into the future.
+func (p *Pacer) delay(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if until := time.Now().Add(d); p.next.Before(until) {
+		p.next = until
+	}
+}
+
+// retryAfter returns how long to wait before retrying a 429 response, using
+// the Retry-After header when present and exponential backoff otherwise.
+func retryAfter(h http.Header, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(h.Get(headerRetryAfter)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	backoff := minBackoff << attempt
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+
+	return backoff
+}
@@ -0,0 +1,150 @@
+package pacer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func headers(remaining, used, reset string) http.Header {
+	h := http.Header{}
+	if remaining != "" {
+		h.Set(headerRemaining, remaining)
+	}
+	if used != "" {
+		h.Set(headerUsed, used)
+	}
+	if reset != "" {
+		h.Set(headerReset, reset)
+	}
+
+	return h
+}
+
+func TestUpdateIgnoresMissingOrMalformedHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{name: "no headers", header: http.Header{}},
+		{name: "missing remaining", header: headers("", "10", "60")},
+		{name: "missing reset", header: headers("590", "10", "")},
+		{name: "malformed remaining", header: headers("many", "10", "60")},
+		{name: "malformed reset", header: headers("590", "10", "soon")},
+		{name: "fractional reset", header: headers("590", "10", "1.5")},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(nil, 0)
+			p.Update(tt.header)
+
+			if rate := p.Rate(); rate != (Rate{}) {
+				t.Errorf("rate %+v, want it unchanged", rate)
+			}
+			if p.interval != 0 || !p.next.IsZero() {
+				t.Errorf("interval %s, next %s; want no pacing", p.interval, p.next)
+			}
+		})
+	}
+}
+
+func TestUpdateReadsHeaders(t *testing.T) {
+	p := New(nil, 0)
+	p.Update(headers("590.0", "", "60"))
+
+	rate := p.Rate()
+	if rate.Remaining != 590 || rate.Used != 0 {
+		t.Errorf("rate %+v, want 590 remaining and 0 used", rate)
+	}
+	if until := time.Until(rate.Reset); until < 59*time.Second || until > 60*time.Second {
+		t.Errorf("reset in %s, want 60s", until)
+	}
+}
+
+func TestUpdateSpreadsBudgetOverWindow(t *testing.T) {
+	p := New(nil, 0)
+
+	// Ten requests may be spent over the next ten seconds, one is kept.
+	p.Update(headers("11", "589", "10"))
+
+	if p.interval < 990*time.Millisecond || p.interval > time.Second {
+		t.Errorf("interval %s, want about 1s", p.interval)
+	}
+}
+
+func TestUpdateKeepsLastRequestInReserve(t *testing.T) {
+	for _, remaining := range []string{"1", "0"} {
+		remaining := remaining
+		t.Run(remaining+" remaining", func(t *testing.T) {
+			p := New(nil, 0)
+			p.Update(headers(remaining, "599", "30"))
+
+			if p.interval != 0 {
+				t.Errorf("interval %s, want 0 once the window is exhausted", p.interval)
+			}
+			if until := time.Until(p.next); until < 29*time.Second {
+				t.Errorf("next request in %s, want it held until the reset in 30s", until)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			if err := p.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("wait returned %v, want it to block until the reset", err)
+			}
+		})
+	}
+}
+
+func TestWaitKeepsOwnRequestBudget(t *testing.T) {
+	p := New(nil, 600)
+	if p.minInterval != 100*time.Millisecond {
+		t.Fatalf("min interval %s, want 100ms", p.minInterval)
+	}
+
+	// Plenty of quota left, yet the own budget spaces requests out.
+	p.Update(headers("599", "1", "600"))
+
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatalf("first wait: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("second wait returned %v, want it spaced by the budget", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		attempt int
+		want    time.Duration
+	}{
+		{name: "header", header: "7", want: 7 * time.Second},
+		{name: "malformed header", header: "later", attempt: 1, want: 2 * minBackoff},
+		{name: "first attempt", want: minBackoff},
+		{name: "capped", attempt: 20, want: maxBackoff},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			if tt.header != "" {
+				h.Set(headerRetryAfter, tt.header)
+			}
+
+			if got := retryAfter(h, tt.attempt); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
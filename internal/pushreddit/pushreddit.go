@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	retryablehttp "github.com/hashicorp/go-retryablehttp"
 	log "github.com/sirupsen/logrus"
+
+	"github.com/carfloresf/reddit-bot/internal/metrics"
 )
 
 type Subreddit struct {
@@ -143,10 +147,14 @@ type Data struct {
 }
 
 type Client struct {
-	h *retryablehttp.Client
+	h         *retryablehttp.Client
+	baseURL   string
+	userAgent string
 }
 
-func NewClient() *Client {
+// NewClient returns a client for the Pushshift-compatible API at baseURL. A
+// non-empty userAgent is sent with every request.
+func NewClient(baseURL, userAgent string) *Client {
 	retryClient := retryablehttp.NewClient()
 	retryClient.RetryMax = 10
 	retryClient.RetryWaitMin = 5 * time.Second
@@ -154,22 +162,42 @@ func NewClient() *Client {
 	retryClient.Backoff = retryablehttp.DefaultBackoff
 	retryClient.HTTPClient.Timeout = 30 * time.Second
 	retryClient.CheckRetry = retryablehttp.DefaultRetryPolicy
+	retryClient.RequestLogHook = func(_ retryablehttp.Logger, _ *http.Request, attempt int) {
+		if attempt > 0 {
+			metrics.PushshiftRetries.Inc()
+		}
+	}
 
 	return &Client{
-		retryClient,
+		h:         retryClient,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		userAgent: userAgent,
 	}
 }
 
 func (c *Client) GetPostsSubreddit(subreddit string, after time.Time, before time.Time, size int) (Data, error) {
-	requestURL := fmt.Sprintf("https://api.pushshift.io/reddit/search/submission/?subreddit=%s&sort=desc&sort_type=created_utc&after=%d&before=%d&size=%d", subreddit, after.Unix(), before.Unix(), size)
+	requestURL := fmt.Sprintf("%s/reddit/search/submission/?subreddit=%s&sort=desc&sort_type=created_utc&after=%d&before=%d&size=%d", c.baseURL, subreddit, after.Unix(), before.Unix(), size)
+
+	request, err := retryablehttp.NewRequest(http.MethodGet, requestURL, nil)
+	if err != nil {
+		return Data{}, err
+	}
 
-	response, err := c.h.Get(requestURL)
+	if c.userAgent != "" {
+		request.Header.Set("User-Agent", c.userAgent)
+	}
+
+	start := time.Now()
+	response, err := c.h.Do(request)
 	if err != nil {
+		metrics.PushshiftDuration.WithLabelValues("error").Observe(time.Since(start).Seconds())
 		log.Errorf("error getting posts: %s", err)
 
 		return Data{}, err
 	}
 
+	metrics.PushshiftDuration.WithLabelValues(strconv.Itoa(response.StatusCode)).Observe(time.Since(start).Seconds())
+
 	if response.StatusCode != http.StatusOK {
 		log.Errorf("error getting posts: %s", response.Status)
 
@@ -0,0 +1,305 @@
+package redditauth
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+
+	"github.com/carfloresf/reddit-bot/internal/badger"
+)
+
+const (
+	namespace       = "oauth"
+	refreshTokenKey = "refresh_token"
+
+	authPath  = "/api/v1/authorize"
+	tokenPath = "/api/v1/access_token"
+
+	// CallbackPath is where the local server receives the authorization code.
+	CallbackPath = "/callback"
+
+	// Key derivation: a random salt per saved token and the scrypt cost
+	// parameters recommended for interactive logins, giving an AES-256 key.
+	saltSize = 16
+	scryptN  = 1 << 15
+	scryptR  = 8
+	scryptP  = 1
+	keySize  = 32
+)
+
+// Scopes requested for the deleter: reading the user's history, editing and
+// deleting, saving, voting and private messages.
+var Scopes = []string{"identity", "history", "read", "edit", "save", "vote", "privatemessages"}
+
+// ErrNoToken is returned when no refresh token has been stored yet.
+var ErrNoToken = errors.New("no refresh token stored, run the authorize command first")
+
+// TokenURL returns the access token endpoint of the Reddit host at baseURL.
+func TokenURL(baseURL string) string {
+	return strings.TrimSuffix(baseURL, "/") + tokenPath
+}
+
+// NewConfig returns the OAuth configuration of a Reddit app, authorizing
+// against the Reddit host at baseURL.
+func NewConfig(baseURL, clientID, secret, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: secret,
+		RedirectURL:  redirectURL,
+		Scopes:       Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:   strings.TrimSuffix(baseURL, "/") + authPath,
+			TokenURL:  TokenURL(baseURL),
+			AuthStyle: oauth2.AuthStyleInHeader,
+		},
+	}
+}
+
+// Store keeps a refresh token in badger, encrypted with AES-GCM under a key
+// derived from a passphrase with scrypt. Every save draws a new salt, stored
+// in front of the nonce and the sealed token.
+type Store struct {
+	db         badger.DB
+	passphrase string
+}
+
+func NewStore(db badger.DB, passphrase string) (*Store, error) {
+	if passphrase == "" {
+		return nil, errors.New("a token encryption key is required")
+	}
+
+	return &Store{db: db, passphrase: passphrase}, nil
+}
+
+// Save encrypts and stores the refresh token.
+func (s *Store) Save(refreshToken string) error {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+
+	aead, err := s.aead(salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = aead.Seal(sealed, nonce, []byte(refreshToken), nil)
+
+	return s.db.Set([]byte(namespace), []byte(refreshTokenKey), sealed)
+}
+
+// Load returns the stored refresh token, or ErrNoToken.
+func (s *Store) Load() (string, error) {
+	sealed, err := s.db.Get([]byte(namespace), []byte(refreshTokenKey))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return "", ErrNoToken
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < saltSize {
+		return "", errors.New("stored refresh token is corrupt")
+	}
+
+	aead, err := s.aead(sealed[:saltSize])
+	if err != nil {
+		return "", err
+	}
+	sealed = sealed[saltSize:]
+
+	size := aead.NonceSize()
+	if len(sealed) < size {
+		return "", errors.New("stored refresh token is corrupt")
+	}
+
+	plain, err := aead.Open(nil, sealed[:size], sealed[size:], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt refresh token: %w", err)
+	}
+
+	return string(plain), nil
+}
+
+// aead derives the key for salt from the passphrase.
+func (s *Store) aead(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(s.passphrase), salt, scryptN, scryptR, scryptP, keySize)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// ClientContext returns ctx carrying the HTTP client token requests go
+// through: transport, sending userAgent. Pass it to TokenSource and Authorize
+// so token refreshes are paced and identified like API calls.
+func ClientContext(ctx context.Context, transport http.RoundTripper, userAgent string) context.Context {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	client := &http.Client{Transport: &userAgentTransport{base: transport, userAgent: userAgent}}
+
+	return context.WithValue(ctx, oauth2.HTTPClient, client)
+}
+
+// userAgentTransport sets the User-Agent header Reddit requires on every
+// request.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.userAgent == "" {
+		return t.base.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("User-Agent", t.userAgent)
+
+	return t.base.RoundTrip(r)
+}
+
+// TokenSource returns a source of access tokens refreshed automatically from
+// the stored refresh token. A refresh token rotated by Reddit is stored again.
+// Refreshes use the HTTP client of ctx, see ClientContext.
+func TokenSource(ctx context.Context, cfg *oauth2.Config, store *Store) (oauth2.TokenSource, error) {
+	refreshToken, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return &persistingSource{
+		src:          cfg.TokenSource(ctx, &oauth2.Token{RefreshToken: refreshToken}),
+		store:        store,
+		refreshToken: refreshToken,
+	}, nil
+}
+
+type persistingSource struct {
+	src   oauth2.TokenSource
+	store *Store
+
+	mu           sync.Mutex
+	refreshToken string
+}
+
+func (p *persistingSource) Token() (*oauth2.Token, error) {
+	token, err := p.src.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if token.RefreshToken != "" && token.RefreshToken != p.refreshToken {
+		if err := p.store.Save(token.RefreshToken); err != nil {
+			log.WithField("error", err).Error("Failed to store rotated refresh token")
+		} else {
+			p.refreshToken = token.RefreshToken
+		}
+	}
+
+	return token, nil
+}
+
+// Authorize runs the authorization-code flow once. It serves the callback on
+// addr, logs the URL to open in a browser, exchanges the returned code and
+// stores the refresh token.
+func Authorize(ctx context.Context, cfg *oauth2.Config, addr string, store *Store) error {
+	stateBytes := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, stateBytes); err != nil {
+		return err
+	}
+	state := hex.EncodeToString(stateBytes)
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(CallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch {
+		case query.Get("state") != state:
+			http.Error(w, "state mismatch", http.StatusBadRequest)
+			return
+		case query.Get("error") != "":
+			http.Error(w, "authorization failed: "+query.Get("error"), http.StatusBadRequest)
+			sendOnce(errs, fmt.Errorf("authorization failed: %s", query.Get("error")))
+			return
+		}
+
+		fmt.Fprintln(w, "Authorization received, you can close this window.")
+		sendOnce(codes, query.Get("code"))
+	})
+
+	server := &http.Server{Handler: mux}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			sendOnce(errs, err)
+		}
+	}()
+	defer server.Close()
+
+	url := cfg.AuthCodeURL(state, oauth2.SetAuthURLParam("duration", "permanent"))
+	log.WithField("url", url).Info("Open this URL in a browser to authorize the app")
+
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	token, err := cfg.Exchange(ctx, code)
+	if err != nil {
+		return fmt.Errorf("exchange code: %w", err)
+	}
+
+	if token.RefreshToken == "" {
+		return errors.New("reddit did not return a refresh token")
+	}
+
+	return store.Save(token.RefreshToken)
+}
+
+func sendOnce[T any](ch chan T, v T) {
+	select {
+	case ch <- v:
+	default:
+	}
+}
@@ -0,0 +1,160 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/carfloresf/reddit-bot/config"
+)
+
+const (
+	ActionKeep   = "keep"
+	ActionDelete = "delete"
+
+	// noMatchRule is reported when no rule matched and the item is kept.
+	noMatchRule = "no matching rule"
+)
+
+// Default reproduces the original deleter policy: delete anything older than
+// a day. It is used when no rules are configured.
+var Default = []config.Rule{
+	{Name: "older than 24h", Action: ActionDelete, OlderThan: 24 * time.Hour},
+}
+
+type (
+	// Item holds the attributes of a comment or post the rules match on.
+	Item struct {
+		Age       time.Duration
+		Subreddit string
+		Score     int
+		Body      string
+		Edited    bool
+		NSFW      bool
+	}
+
+	// Decision is the action chosen for an item and the rule that chose it.
+	Decision struct {
+		Action string
+		Rule   string
+	}
+
+	// Engine evaluates items against an ordered list of rules.
+	Engine struct {
+		rules []rule
+	}
+
+	rule struct {
+		config.Rule
+		subreddits map[string]struct{}
+		keywords   []string
+		regex      *regexp.Regexp
+	}
+)
+
+// New compiles the given rules into an Engine. Rules are evaluated in order
+// and the first match decides. An error is returned for an unknown action or
+// an invalid regular expression.
+func New(rules []config.Rule) (*Engine, error) {
+	engine := &Engine{}
+
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		if r.Action != ActionKeep && r.Action != ActionDelete {
+			return nil, fmt.Errorf("rule %q: unknown action %q", r.Name, r.Action)
+		}
+
+		compiled := rule{Rule: r}
+
+		if len(r.Subreddits) > 0 {
+			compiled.subreddits = make(map[string]struct{}, len(r.Subreddits))
+			for _, s := range r.Subreddits {
+				compiled.subreddits[strings.ToLower(s)] = struct{}{}
+			}
+		}
+
+		for _, k := range r.Keywords {
+			compiled.keywords = append(compiled.keywords, strings.ToLower(k))
+		}
+
+		if r.Regex != "" {
+			re, err := regexp.Compile(r.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: %w", r.Name, err)
+			}
+			compiled.regex = re
+		}
+
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	return engine, nil
+}
+
+// Evaluate returns the decision of the first rule matching the item. Items no
+// rule matches are kept.
+func (e *Engine) Evaluate(item Item) Decision {
+	for _, r := range e.rules {
+		if r.matches(item) {
+			return Decision{Action: r.Action, Rule: r.Name}
+		}
+	}
+
+	return Decision{Action: ActionKeep, Rule: noMatchRule}
+}
+
+func (r rule) matches(item Item) bool {
+	if r.OlderThan > 0 && item.Age <= r.OlderThan {
+		return false
+	}
+
+	if r.NewerThan > 0 && item.Age >= r.NewerThan {
+		return false
+	}
+
+	if r.subreddits != nil {
+		if _, ok := r.subreddits[strings.ToLower(item.Subreddit)]; !ok {
+			return false
+		}
+	}
+
+	if r.MinScore != nil && item.Score < *r.MinScore {
+		return false
+	}
+
+	if r.MaxScore != nil && item.Score > *r.MaxScore {
+		return false
+	}
+
+	if len(r.keywords) > 0 && !containsAny(strings.ToLower(item.Body), r.keywords) {
+		return false
+	}
+
+	if r.regex != nil && !r.regex.MatchString(item.Body) {
+		return false
+	}
+
+	if r.Edited != nil && item.Edited != *r.Edited {
+		return false
+	}
+
+	if r.NSFW != nil && item.NSFW != *r.NSFW {
+		return false
+	}
+
+	return true
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+
+	return false
+}
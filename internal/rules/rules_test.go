@@ -0,0 +1,163 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/carfloresf/reddit-bot/config"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestEvaluate(t *testing.T) {
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name  string
+		rules []config.Rule
+		item  Item
+		want  Decision
+	}{
+		{
+			name: "first match wins",
+			rules: []config.Rule{
+				{Name: "keep golang", Action: ActionKeep, Subreddits: []string{"golang"}},
+				{Name: "delete old", Action: ActionDelete, OlderThan: day},
+			},
+			item: Item{Age: 2 * day, Subreddit: "golang"},
+			want: Decision{Action: ActionKeep, Rule: "keep golang"},
+		},
+		{
+			name: "later rule matches when earlier ones do not",
+			rules: []config.Rule{
+				{Name: "keep golang", Action: ActionKeep, Subreddits: []string{"golang"}},
+				{Name: "delete old", Action: ActionDelete, OlderThan: day},
+			},
+			item: Item{Age: 2 * day, Subreddit: "rust"},
+			want: Decision{Action: ActionDelete, Rule: "delete old"},
+		},
+		{
+			name:  "no match keeps the item",
+			rules: []config.Rule{{Name: "delete old", Action: ActionDelete, OlderThan: day}},
+			item:  Item{Age: time.Hour},
+			want:  Decision{Action: ActionKeep, Rule: noMatchRule},
+		},
+		{
+			name:  "unnamed rules are numbered",
+			rules: []config.Rule{{Action: ActionKeep}, {Action: ActionDelete}},
+			item:  Item{},
+			want:  Decision{Action: ActionKeep, Rule: "rule 1"},
+		},
+		{
+			name:  "older_than excludes the exact age",
+			rules: []config.Rule{{Name: "old", Action: ActionDelete, OlderThan: day}},
+			item:  Item{Age: day},
+			want:  Decision{Action: ActionKeep, Rule: noMatchRule},
+		},
+		{
+			name:  "older_than matches just past the age",
+			rules: []config.Rule{{Name: "old", Action: ActionDelete, OlderThan: day}},
+			item:  Item{Age: day + time.Second},
+			want:  Decision{Action: ActionDelete, Rule: "old"},
+		},
+		{
+			name:  "newer_than excludes the exact age",
+			rules: []config.Rule{{Name: "new", Action: ActionDelete, NewerThan: day}},
+			item:  Item{Age: day},
+			want:  Decision{Action: ActionKeep, Rule: noMatchRule},
+		},
+		{
+			name:  "newer_than matches just under the age",
+			rules: []config.Rule{{Name: "new", Action: ActionDelete, NewerThan: day}},
+			item:  Item{Age: day - time.Second},
+			want:  Decision{Action: ActionDelete, Rule: "new"},
+		},
+		{
+			name:  "subreddits match case-insensitively",
+			rules: []config.Rule{{Name: "sub", Action: ActionDelete, Subreddits: []string{"GoLang"}}},
+			item:  Item{Subreddit: "golang"},
+			want:  Decision{Action: ActionDelete, Rule: "sub"},
+		},
+		{
+			name:  "other subreddits do not match",
+			rules: []config.Rule{{Name: "sub", Action: ActionDelete, Subreddits: []string{"golang"}}},
+			item:  Item{Subreddit: "rust"},
+			want:  Decision{Action: ActionKeep, Rule: noMatchRule},
+		},
+		{
+			name:  "unset score bounds match any score",
+			rules: []config.Rule{{Name: "any", Action: ActionDelete}},
+			item:  Item{Score: -50},
+			want:  Decision{Action: ActionDelete, Rule: "any"},
+		},
+		{
+			name:  "min_score is inclusive",
+			rules: []config.Rule{{Name: "min", Action: ActionDelete, MinScore: intPtr(0)}},
+			item:  Item{Score: 0},
+			want:  Decision{Action: ActionDelete, Rule: "min"},
+		},
+		{
+			name:  "min_score excludes lower scores",
+			rules: []config.Rule{{Name: "min", Action: ActionDelete, MinScore: intPtr(0)}},
+			item:  Item{Score: -1},
+			want:  Decision{Action: ActionKeep, Rule: noMatchRule},
+		},
+		{
+			name:  "max_score is inclusive",
+			rules: []config.Rule{{Name: "max", Action: ActionDelete, MaxScore: intPtr(5)}},
+			item:  Item{Score: 5},
+			want:  Decision{Action: ActionDelete, Rule: "max"},
+		},
+		{
+			name:  "max_score excludes higher scores",
+			rules: []config.Rule{{Name: "max", Action: ActionDelete, MaxScore: intPtr(5)}},
+			item:  Item{Score: 6},
+			want:  Decision{Action: ActionKeep, Rule: noMatchRule},
+		},
+		{
+			name:  "keywords match case-insensitively",
+			rules: []config.Rule{{Name: "kw", Action: ActionDelete, Keywords: []string{"Secret"}}},
+			item:  Item{Body: "my SECRET plan"},
+			want:  Decision{Action: ActionDelete, Rule: "kw"},
+		},
+		{
+			name:  "regex must match the body",
+			rules: []config.Rule{{Name: "re", Action: ActionDelete, Regex: `^\d+$`}},
+			item:  Item{Body: "12a"},
+			want:  Decision{Action: ActionKeep, Rule: noMatchRule},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := New(tt.rules)
+			if err != nil {
+				t.Fatalf("compile rules: %s", err)
+			}
+
+			if got := engine.Evaluate(tt.item); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.Rule
+	}{
+		{name: "unknown action", rule: config.Rule{Action: "archive"}},
+		{name: "invalid regex", rule: config.Rule{Action: ActionDelete, Regex: "("}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]config.Rule{tt.rule}); err == nil {
+				t.Errorf("no error")
+			}
+		})
+	}
+}
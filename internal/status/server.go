@@ -0,0 +1,274 @@
+package status
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// shutdownTimeout bounds how long in-flight API requests may take once the
+// process is stopping.
+const shutdownTimeout = 5 * time.Second
+
+const (
+	// CSRFHeader carries the CSRF token on the responses of protected
+	// handlers. Requests may send it back in this header instead of the
+	// CSRFField form field.
+	CSRFHeader = "X-CSRF-Token"
+	CSRFField  = "csrf_token"
+)
+
+// Server serves the status and control API of one or more named trackers:
+//
+//	GET  /healthz  liveness
+//	GET  /status   state, progress counters and last errors of every tracker
+//	POST /run      trigger a run
+//	POST /pause    pause before the next item
+//	POST /resume   resume a paused worker
+//
+// The control endpoints act on every tracker, or on the one named by the
+// name query parameter. /run answers 409 Conflict for trackers no scheduler
+// listens to. The control endpoints are only served when a secret is
+// configured; without one, anyone reaching the address could use them.
+// All but /healthz are protected then, see Protect; a script reads the CSRF
+// token from the headers of GET /status and sends it back:
+//
+//	token=$(curl -s -u :$SECRET -D - -o /dev/null localhost:8080/status | sed -n 's/^X-Csrf-Token: //ip' | tr -d '\r')
+//	curl -u :$SECRET -H "X-CSRF-Token: $token" -X POST localhost:8080/run
+type Server struct {
+	trackers map[string]*Tracker
+	mux      *http.ServeMux
+
+	// secret is required as the basic authentication password by
+	// protected handlers. csrfToken is made anew for every process.
+	secret    string
+	csrfToken string
+}
+
+// NewServer returns a server whose protected handlers require secret. With an
+// empty secret only /healthz and a read-only /status are served.
+func NewServer(secret string) *Server {
+	token := make([]byte, 32)
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+
+	s := &Server{
+		trackers:  make(map[string]*Tracker),
+		mux:       http.NewServeMux(),
+		secret:    secret,
+		csrfToken: hex.EncodeToString(token),
+	}
+
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+
+	if secret == "" {
+		log.Warn("No HTTP secret configured, serving the status API read-only")
+		s.mux.HandleFunc("/status", s.handleStatus)
+		return s
+	}
+
+	s.mux.Handle("/status", s.Protect(http.HandlerFunc(s.handleStatus)))
+	s.mux.Handle("/run", s.Protect(s.control(func(t *Tracker) error { return t.Trigger() })))
+	s.mux.Handle("/pause", s.Protect(s.control(func(t *Tracker) error { t.Pause(); return nil })))
+	s.mux.Handle("/resume", s.Protect(s.control(func(t *Tracker) error { t.Resume(); return nil })))
+
+	return s
+}
+
+// Register adds a tracker under name. Trackers must be registered before the
+// server starts.
+func (s *Server) Register(name string, t *Tracker) {
+	s.trackers[name] = t
+}
+
+// Handle adds a handler for pattern, next to the API endpoints.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HasSecret reports whether a secret is configured, without which protected
+// handlers refuse every request.
+func (s *Server) HasSecret() bool {
+	return s.secret != ""
+}
+
+// CSRFToken returns the token requests changing state through a protected
+// handler must carry.
+func (s *Server) CSRFToken() string {
+	return s.csrfToken
+}
+
+// Protect wraps handler so it asks for the secret as the password of HTTP
+// basic authentication. Without a secret every request is refused. Requests other than GET and
+// HEAD must also come from the same origin and carry the CSRF token, in the
+// CSRFField form field or the CSRFHeader header. The token is sent on every
+// response of the handler.
+func (s *Server) Protect(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.secret == "" {
+			http.Error(w, "no secret configured", http.StatusForbidden)
+			return
+		}
+
+		_, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(s.secret)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="reddit-bot"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set(CSRFHeader, s.csrfToken)
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if !sameOrigin(r) {
+				http.Error(w, "cross-origin request", http.StatusForbidden)
+				return
+			}
+
+			token := r.Header.Get(CSRFHeader)
+			if token == "" {
+				token = r.FormValue(CSRFField)
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.csrfToken)) != 1 {
+				http.Error(w, "missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin reports whether a request was not sent by a page of another
+// origin. Requests from outside a browser carry neither header.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	return err == nil && u.Host == r.Host
+}
+
+// ListenAndServe serves the API on addr until ctx is done, then shuts the
+// server down gracefully.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+
+	log.WithField("addr", listener.Addr().String()).Info("Status API listening")
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	statuses := make(map[string]Status, len(s.trackers))
+	for name, t := range s.trackers {
+		statuses[name] = t.Status()
+	}
+
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// control returns a handler applying action to the selected trackers.
+func (s *Server) control(action func(t *Tracker) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		names := make([]string, 0, len(s.trackers))
+		if r.URL.Query().Has("name") {
+			name := r.URL.Query().Get("name")
+			if _, ok := s.trackers[name]; !ok {
+				http.Error(w, "unknown name", http.StatusNotFound)
+				return
+			}
+			names = append(names, name)
+		} else {
+			for name := range s.trackers {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		results := make(map[string]string, len(names))
+		code := http.StatusAccepted
+		for _, name := range names {
+			results[name] = "ok"
+			if err := action(s.trackers[name]); err != nil {
+				results[name] = err.Error()
+				code = http.StatusConflict
+			}
+		}
+
+		writeJSON(w, code, results)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithField("error", err).Error("Failed to write response")
+	}
+}
@@ -0,0 +1,218 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Run states reported by a Tracker.
+const (
+	StateIdle    = "idle"
+	StateRunning = "running"
+)
+
+// maxErrors is the number of recent errors a Tracker keeps.
+const maxErrors = 20
+
+// ErrRunning is returned when a run is triggered while one is in progress.
+var ErrRunning = errors.New("a run is already in progress")
+
+// ErrNotScheduled is returned when a run is triggered but no scheduler waits
+// for triggers, as in a one-shot run.
+var ErrNotScheduled = errors.New("no scheduler is listening for triggers")
+
+type (
+	// Tracker holds the run state, progress counters and recent errors of a
+	// worker, and carries the trigger, pause and resume requests made through
+	// the API back to it. It is safe for concurrent use.
+	Tracker struct {
+		mu        sync.Mutex
+		state     string
+		paused    bool
+		resumed   chan struct{}
+		runStart  time.Time
+		lastRun   time.Time
+		lastError string
+		counters  map[string]int64
+		errors    []Error
+
+		trigger   chan struct{}
+		listening bool
+	}
+
+	// Error is an error recorded by a Tracker.
+	Error struct {
+		At      time.Time `json:"at"`
+		Message string    `json:"message"`
+	}
+
+	// Status is a snapshot of a Tracker.
+	Status struct {
+		State        string           `json:"state"`
+		Paused       bool             `json:"paused"`
+		RunStarted   *time.Time       `json:"run_started,omitempty"`
+		LastRun      *time.Time       `json:"last_run,omitempty"`
+		LastRunError string           `json:"last_run_error,omitempty"`
+		Counters     map[string]int64 `json:"counters"`
+		Errors       []Error          `json:"errors"`
+	}
+)
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		state:    StateIdle,
+		counters: make(map[string]int64),
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// StartRun marks a run as started and resets the progress counters.
+func (t *Tracker) StartRun() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state = StateRunning
+	t.runStart = time.Now()
+	t.counters = make(map[string]int64)
+}
+
+// FinishRun marks the current run as finished, with its error if it failed.
+func (t *Tracker) FinishRun(err error) {
+	if err != nil {
+		t.Error(err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.state = StateIdle
+	t.lastRun = time.Now()
+	t.lastError = ""
+	if err != nil {
+		t.lastError = err.Error()
+	}
+}
+
+// Add increases a progress counter.
+func (t *Tracker) Add(counter string, n int64) {
+	t.mu.Lock()
+	t.counters[counter] += n
+	t.mu.Unlock()
+}
+
+// Error records an error, dropping the oldest once maxErrors are kept.
+func (t *Tracker) Error(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.errors = append(t.errors, Error{At: time.Now(), Message: err.Error()})
+	if len(t.errors) > maxErrors {
+		t.errors = t.errors[len(t.errors)-maxErrors:]
+	}
+}
+
+// Status returns a snapshot of the tracker.
+func (t *Tracker) Status() Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := Status{
+		State:        t.state,
+		Paused:       t.paused,
+		LastRunError: t.lastError,
+		Counters:     make(map[string]int64, len(t.counters)),
+		Errors:       append([]Error{}, t.errors...),
+	}
+
+	for name, value := range t.counters {
+		s.Counters[name] = value
+	}
+
+	if t.state == StateRunning {
+		started := t.runStart
+		s.RunStarted = &started
+	}
+
+	if !t.lastRun.IsZero() {
+		last := t.lastRun
+		s.LastRun = &last
+	}
+
+	return s
+}
+
+// Trigger asks for a run to start now. Triggers made while one is already
+// pending are merged into it.
+func (t *Tracker) Trigger() error {
+	t.mu.Lock()
+	running, listening := t.state == StateRunning, t.listening
+	t.mu.Unlock()
+
+	if !listening {
+		return ErrNotScheduled
+	}
+
+	if running {
+		return ErrRunning
+	}
+
+	select {
+	case t.trigger <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Triggered returns the channel receiving a value for each trigger. Until it
+// is called, Trigger fails with ErrNotScheduled.
+func (t *Tracker) Triggered() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.listening = true
+
+	return t.trigger
+}
+
+// Pause asks the worker to stop before its next item.
+func (t *Tracker) Pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.paused {
+		t.paused = true
+		t.resumed = make(chan struct{})
+	}
+}
+
+// Resume lets a paused worker carry on.
+func (t *Tracker) Resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.paused {
+		t.paused = false
+		close(t.resumed)
+	}
+}
+
+// WaitIfPaused blocks while the tracker is paused, or until ctx is done.
+func (t *Tracker) WaitIfPaused(ctx context.Context) error {
+	t.mu.Lock()
+	paused, resumed := t.paused, t.resumed
+	t.mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}